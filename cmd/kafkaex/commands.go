@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/illidaris/watermillex/kafkaex"
+)
+
+// messageView 消息信封的可读形式，用于consume输出。
+type messageView struct {
+	MsgId      string            `json:"msgid"`
+	Topic      string            `json:"topic"`
+	Group      string            `json:"group"`
+	Key        string            `json:"key,omitempty"`
+	TraceId    string            `json:"traceid,omitempty"`
+	RetryIndex int64             `json:"retryindex"`
+	RetryMax   int64             `json:"retrymax"`
+	ExecType   int32             `json:"exectype"`
+	Timeout    string            `json:"timeout"`
+	Execer     string            `json:"execer,omitempty"`
+	ExecAt     string            `json:"execat,omitempty"`
+	ExecErr    string            `json:"execerr,omitempty"`
+	PublishAt  string            `json:"pubat,omitempty"`
+	Partition  int32             `json:"partition"`
+	Offset     int64             `json:"offset"`
+	Metas      map[string]string `json:"metas,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Value      string            `json:"value"`
+}
+
+// newMessageView 将BoxMessage转换为可读形式。
+func newMessageView(box *kafkaex.BoxMessage) *messageView {
+	v := &messageView{
+		MsgId:      box.MsgId,
+		Topic:      box.Topic,
+		Group:      box.Group,
+		Key:        box.Key,
+		TraceId:    box.TraceId,
+		RetryIndex: box.RetryIndex,
+		RetryMax:   box.RetryMax,
+		ExecType:   box.ExecType,
+		Timeout:    box.HandleTimeout.String(),
+		Execer:     box.Execer,
+		ExecErr:    box.ExecErr,
+		Partition:  box.Partition,
+		Offset:     box.Offset,
+		Metas:      box.Metas,
+		Headers:    box.Headers,
+		Value:      string(box.Value),
+	}
+	if box.ExecAt > 0 {
+		v.ExecAt = time.Unix(box.ExecAt, 0).Format(time.RFC3339)
+	}
+	if box.PublishAt > 0 {
+		v.PublishAt = time.UnixMilli(box.PublishAt).Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// writeJSON 以单行JSON输出。
+func writeJSON(w io.Writer, v any) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(bs))
+	return err
+}
+
+// publish 构建BoxMessage并发布。
+func (a *app) publish(ctx context.Context, args []string) error {
+	cf := &configFlags{}
+	fs := a.newFlagSet("publish", cf)
+	topic := fs.String("topic", "", "发布的主题")
+	group := fs.String("group", "", "消息组别")
+	key := fs.String("key", "", "消息键(分区键)")
+	value := fs.String("value", "", "消息值，为空时读取标准输入")
+	traceId := fs.String("trace-id", "", "跟踪ID")
+	retryMax := fs.Int64("retry-max", 0, "最大重试次数")
+	timeout := fs.Duration("timeout", 0, "处理超时时间")
+	headers := headerFlags{}
+	fs.Var(headers, "header", "自定义消息头key=value，可重复")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *topic == "" {
+		return fmt.Errorf("%w: -topic is required", errUsage)
+	}
+	cfg, err := a.loadConfig(cf)
+	if err != nil {
+		return err
+	}
+	box := kafkaex.NewBoxMessage().WithOption(
+		kafkaex.WithTopic(*topic),
+		kafkaex.WithGroup(*group),
+		kafkaex.WithKey(*key),
+		kafkaex.WithTraceID(*traceId),
+		kafkaex.WithRetryMax(*retryMax),
+	)
+	if *timeout > 0 {
+		box.WithOption(kafkaex.WithHandleTimeout(*timeout))
+	}
+	for k, v := range headers {
+		if err := box.SetHeader(k, v); err != nil {
+			return fmt.Errorf("header %s: %w", k, err)
+		}
+	}
+	if *value != "" {
+		box.Value = []byte(*value)
+	} else if box.Value, err = io.ReadAll(a.stdin); err != nil {
+		return err
+	}
+	box.WithContext(ctx)
+	if err := a.newManager(cfg).Publish(*topic, box); err != nil {
+		return err
+	}
+	return writeJSON(a.stdout, newMessageView(box))
+}
+
+// consume 消费主题并输出解析后的消息信封，-count大于0时消费指定数量后退出。
+func (a *app) consume(ctx context.Context, args []string) error {
+	cf := &configFlags{}
+	fs := a.newFlagSet("consume", cf)
+	topic := fs.String("topic", "", "消费的主题")
+	group := fs.String("group", "kafkaex-cli", "消费组")
+	count := fs.Int("count", 0, "消费指定数量后退出，0表示持续消费")
+	newest := fs.Bool("newest", false, "无提交偏移量时从最新位置开始消费")
+	interop := fs.Bool("interop", false, "兼容模式，补全外部生产者消息的信封")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *topic == "" {
+		return fmt.Errorf("%w: -topic is required", errUsage)
+	}
+	cfg, err := a.loadConfig(cf)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	views := make(chan *messageView)
+	opts := []kafkaex.Option{
+		kafkaex.WithGroup(*group),
+		kafkaex.WithHandle(func(ctx context.Context, box *kafkaex.BoxMessage) error {
+			select {
+			case views <- newMessageView(box):
+			case <-ctx.Done():
+			}
+			return nil
+		}),
+	}
+	if *newest {
+		opts = append(opts, kafkaex.WithOverwrite(func(c *sarama.Config) *sarama.Config {
+			c.Consumer.Offsets.Initial = sarama.OffsetNewest
+			return c
+		}))
+	}
+	if *interop {
+		opts = append(opts, kafkaex.WithInterop())
+	}
+	if err := a.newManager(cfg).RegisterSubscriber(ctx, *topic, opts...); err != nil {
+		return err
+	}
+	for n := 0; *count == 0 || n < *count; n++ {
+		select {
+		case v := <-views:
+			if err := writeJSON(a.stdout, v); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// bindFilter 注册死信检索条件参数。
+func bindFilter(fs *flag.FlagSet) *kafkaex.DeadLetterFilter {
+	f := &kafkaex.DeadLetterFilter{}
+	fs.StringVar(&f.Topic, "topic", "", "源主题")
+	fs.StringVar(&f.Group, "group", "", "源组别")
+	fs.StringVar(&f.Error, "error", "", "错误信息包含的内容")
+	fs.Int64Var(&f.Begin, "begin", 0, "进入死信的起始时间戳(含)")
+	fs.Int64Var(&f.End, "end", 0, "进入死信的结束时间戳(不含)")
+	fs.IntVar(&f.Offset, "offset", 0, "分页偏移量")
+	fs.IntVar(&f.Limit, "limit", 0, "分页大小，0表示不限制")
+	return f
+}
+
+// emptyFilter 判断检索条件是否为空。
+func emptyFilter(f *kafkaex.DeadLetterFilter) bool {
+	return f.Topic == "" && f.Group == "" && f.Error == "" && f.Begin == 0 && f.End == 0
+}
+
+// deadLetters 打开死信存储并创建DeadLetters。
+func (a *app) deadLetters(cf *configFlags) (*kafkaex.DeadLetters, func() error, error) {
+	cfg, err := a.loadConfig(cf)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, closeFn, err := a.openStore(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kafkaex.NewDeadLetters(store, a.newManager(cfg)), closeFn, nil
+}
+
+// dlqList 检索死信，逐行输出JSON。
+func (a *app) dlqList(ctx context.Context, args []string) error {
+	cf := &configFlags{}
+	fs := a.newFlagSet("dlq list", cf)
+	filter := bindFilter(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	dead, closeFn, err := a.deadLetters(cf)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	dls, err := dead.List(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, dl := range dls {
+		if err := writeJSON(a.stdout, dl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dlqReplay 重放死信，-id指定单条（可用-value修改消息值），否则按条件批量重放。
+func (a *app) dlqReplay(ctx context.Context, args []string) error {
+	cf := &configFlags{}
+	fs := a.newFlagSet("dlq replay", cf)
+	filter := bindFilter(fs)
+	id := fs.String("id", "", "重放单条死信的ID")
+	value := fs.String("value", "", "重放前替换的消息值，仅-id时有效")
+	all := fs.Bool("all", false, "未指定条件时确认重放全部死信")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *id == "" && emptyFilter(filter) && !*all {
+		return fmt.Errorf("%w: -id, a filter or -all is required", errUsage)
+	}
+	dead, closeFn, err := a.deadLetters(cf)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	if *id != "" {
+		var edit func(*kafkaex.BoxMessage) error
+		if *value != "" {
+			edit = func(box *kafkaex.BoxMessage) error {
+				box.Value = []byte(*value)
+				return nil
+			}
+		}
+		if err := dead.Replay(ctx, *id, edit); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(a.stdout, "replayed 1")
+		return err
+	}
+	count, err := dead.ReplayFilter(ctx, filter)
+	fmt.Fprintf(a.stdout, "replayed %d\n", count)
+	return err
+}
+
+// dlqPurge 按条件丢弃死信。
+func (a *app) dlqPurge(ctx context.Context, args []string) error {
+	cf := &configFlags{}
+	fs := a.newFlagSet("dlq purge", cf)
+	filter := bindFilter(fs)
+	all := fs.Bool("all", false, "未指定条件时确认丢弃全部死信")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if emptyFilter(filter) && !*all {
+		return fmt.Errorf("%w: a filter or -all is required", errUsage)
+	}
+	dead, closeFn, err := a.deadLetters(cf)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	count, err := dead.Purge(ctx, filter)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(a.stdout, "purged %d\n", count)
+	return err
+}
+
+// retryStats 输出重试队列各分区的积压。配置了重试主题的命名模板时，按-origin指定的源订阅查询各自的重试主题与内置消费组。
+func (a *app) retryStats(ctx context.Context, args []string) error {
+	cf := &configFlags{}
+	fs := a.newFlagSet("retry stats", cf)
+	topic := fs.String("topic", "", "重试主题，默认为共享的内置重试主题或-origin对应的重试主题")
+	group := fs.String("group", kafkaex.APHMQIGP_INNER, "重试消费组，与-topic一起使用")
+	origins := &originFlags{}
+	fs.Var(origins, "origin", "源订阅，格式为topic:group，可重复，按命名模板查询对应的重试主题")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := a.loadConfig(cf)
+	if err != nil {
+		return err
+	}
+	targets := [][2]string{{kafkaex.APHMQITP_RETRY, *group}}
+	switch {
+	case *topic != "":
+		targets[0][0] = *topic
+	case len(*origins) > 0:
+		targets = targets[:0]
+		seen := map[string]bool{}
+		for _, o := range *origins {
+			t := kafkaex.RetryTopic(o[0], o[1])
+			if !seen[t] {
+				seen[t] = true
+				targets = append(targets, [2]string{t, kafkaex.InnerGroup(o[0], o[1])})
+			}
+		}
+	case cfg.Naming.Retry != "":
+		return fmt.Errorf("%w: -origin or -topic is required when naming.retry is set", errUsage)
+	}
+	bs := []*kafkaex.Backlog{}
+	for _, t := range targets {
+		v, err := a.backlog(ctx, t[0], t[1])
+		if err != nil {
+			return err
+		}
+		bs = append(bs, v...)
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tGROUP\tPARTITION\tNEWEST\tCOMMITTED\tLAG")
+	var total int64
+	for _, b := range bs {
+		total += b.Lag
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n", b.Topic, b.Group, b.Partition, b.Newest, b.Committed, b.Lag)
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t\t\t%d\n", total)
+	return w.Flush()
+}
+
+// topicsEnsure 按YAML配置创建缺失的主题并报告差异，-plan仅比对，-apply修正可修正的差异。
+func (a *app) topicsEnsure(ctx context.Context, args []string) error {
+	cf := &configFlags{}
+	fs := a.newFlagSet("topics ensure", cf)
+	file := fs.String("file", "", "主题配置YAML文件")
+	plan := fs.Bool("plan", false, "仅比对差异，不创建主题也不修改配置")
+	apply := fs.Bool("apply", false, "修正可修正的差异：增加分区数、修改主题配置")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("%w: -file is required", errUsage)
+	}
+	cfg, err := a.loadConfig(cf)
+	if err != nil {
+		return err
+	}
+	specs, err := kafkaex.LoadTopicSpecs(*file)
+	if err != nil {
+		return err
+	}
+	if len(specs) == 0 {
+		return errors.New("no topic in spec file")
+	}
+	admin, err := a.newAdmin(cfg)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	opts := []kafkaex.ProvisionOption{}
+	if *plan {
+		opts = append(opts, kafkaex.WithProvisionPlan())
+	}
+	if *apply {
+		opts = append(opts, kafkaex.WithProvisionApply())
+	}
+	report, err := kafkaex.ProvisionTopics(admin, specs, opts...)
+	for _, name := range report.Created {
+		fmt.Fprintln(a.stdout, "created", name)
+	}
+	for _, d := range report.Drifts {
+		fmt.Fprintf(a.stdout, "drift %s %s want=%s got=%s\n", d.Topic, d.Field, d.Want, d.Got)
+	}
+	for _, d := range report.Applied {
+		fmt.Fprintf(a.stdout, "applied %s %s=%s\n", d.Topic, d.Field, d.Want)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(a.stdout, "%d topics ensured, %d created, %d drifts, %d applied\n",
+		len(specs), len(report.Created), len(report.Drifts), len(report.Applied))
+	return err
+}
@@ -0,0 +1,303 @@
+// kafkaex 命令行工具，使用kafkaex的消息信封格式发布、消费消息，并管理死信、重试队列与主题。
+//
+// 用法:
+//
+//	kafkaex publish -topic orders -key 1 -header event=created < payload.json
+//	kafkaex consume -topic orders -count 10
+//	kafkaex dlq list|replay|purge -store file:/var/lib/kafkaex/dead -topic orders
+//	kafkaex retry stats [-origin orders:billing]
+//	kafkaex topics ensure -file topics.yaml [-plan|-apply]
+//
+// 配置优先级: 命令行参数 > 环境变量(KAFKAEX_BROKERS、KAFKAEX_USER、KAFKAEX_PASSWORD、KAFKAEX_NAME、KAFKAEX_STORE) > YAML配置文件(-config或KAFKAEX_CONFIG)。
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/IBM/sarama"
+	"github.com/illidaris/watermillex/kafkaex"
+	"gopkg.in/yaml.v3"
+	_ "modernc.org/sqlite"
+)
+
+// errUsage 参数错误，输出用法后以状态码2退出。
+var errUsage = errors.New("usage")
+
+// config 命令行工具的连接配置。
+type config struct {
+	Brokers  []string            `yaml:"brokers"`  // Kafka Broker列表
+	User     string              `yaml:"user"`     // SASL用户名
+	Password string              `yaml:"password"` // SASL密码
+	Name     string              `yaml:"name"`     // 节点名
+	Store    string              `yaml:"store"`    // 死信存储，file:<目录> 或 sqlite:<DSN>
+	Naming   kafkaex.TopicNaming `yaml:"naming"`   // 重试与死信主题的命名模板，字段为retry、dead、group
+}
+
+// configFlags 绑定到每个子命令的公共参数。
+type configFlags struct {
+	path     string
+	brokers  string
+	user     string
+	password string
+	name     string
+	store    string
+}
+
+// bind 将公共参数注册到FlagSet。
+func (c *configFlags) bind(fs *flag.FlagSet) {
+	fs.StringVar(&c.path, "config", "", "YAML配置文件")
+	fs.StringVar(&c.brokers, "brokers", "", "Kafka Broker列表，逗号分隔")
+	fs.StringVar(&c.user, "user", "", "SASL用户名")
+	fs.StringVar(&c.password, "password", "", "SASL密码")
+	fs.StringVar(&c.name, "name", "", "节点名")
+	fs.StringVar(&c.store, "store", "", "死信存储，file:<目录> 或 sqlite:<DSN>")
+}
+
+// app 命令行工具，依赖的外部资源均可替换以便测试。
+type app struct {
+	stdin      io.Reader
+	stdout     io.Writer
+	stderr     io.Writer
+	getenv     func(string) string
+	newManager func(cfg *config) kafkaex.IManager
+	newAdmin   func(cfg *config) (sarama.ClusterAdmin, error)
+	backlog    func(ctx context.Context, topic, group string) ([]*kafkaex.Backlog, error)
+	openStore  func(cfg *config) (kafkaex.DeadLetterStore, func() error, error)
+}
+
+// newApp 创建连接真实Kafka的命令行工具。
+func newApp() *app {
+	return &app{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		getenv: os.Getenv,
+		newManager: func(cfg *config) kafkaex.IManager {
+			return kafkaex.NewWaterMillManager()
+		},
+		newAdmin: func(cfg *config) (sarama.ClusterAdmin, error) {
+			return kafkaex.NewClusterAdmin()
+		},
+		backlog:   kafkaex.TopicBacklog,
+		openStore: openStore,
+	}
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	os.Exit(newApp().run(ctx, os.Args[1:]))
+}
+
+// run 执行子命令，返回进程退出码。
+func (a *app) run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		a.usage()
+		return 2
+	}
+	var err error
+	switch cmd, rest := args[0], args[1:]; cmd {
+	case "publish":
+		err = a.publish(ctx, rest)
+	case "consume":
+		err = a.consume(ctx, rest)
+	case "dlq":
+		err = a.sub(ctx, rest, map[string]func(context.Context, []string) error{
+			"list":   a.dlqList,
+			"replay": a.dlqReplay,
+			"purge":  a.dlqPurge,
+		})
+	case "retry":
+		err = a.sub(ctx, rest, map[string]func(context.Context, []string) error{
+			"stats": a.retryStats,
+		})
+	case "topics":
+		err = a.sub(ctx, rest, map[string]func(context.Context, []string) error{
+			"ensure": a.topicsEnsure,
+		})
+	default:
+		err = errUsage
+	}
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 2
+	case errors.Is(err, errUsage):
+		if err != errUsage {
+			fmt.Fprintln(a.stderr, "error:", err)
+		}
+		a.usage()
+		return 2
+	default:
+		fmt.Fprintln(a.stderr, "error:", err)
+		return 1
+	}
+}
+
+// sub 执行二级子命令。
+func (a *app) sub(ctx context.Context, args []string, cmds map[string]func(context.Context, []string) error) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	f, ok := cmds[args[0]]
+	if !ok {
+		return errUsage
+	}
+	return f(ctx, args[1:])
+}
+
+// usage 输出用法。
+func (a *app) usage() {
+	fmt.Fprint(a.stderr, `usage: kafkaex <command> [flags]
+
+commands:
+  publish       构建BoxMessage并发布，消息值取自-value或标准输入
+  consume       消费主题并输出解析后的消息信封
+  dlq list      检索死信
+  dlq replay    重放死信，-id指定单条，否则按条件批量重放
+  dlq purge     按条件丢弃死信
+  retry stats   查看重试队列积压
+  topics ensure 按YAML配置创建缺失的主题并报告差异，-plan仅比对，-apply修正差异
+
+使用 kafkaex <command> -h 查看参数
+`)
+}
+
+// newFlagSet 创建绑定了公共参数的FlagSet。
+func (a *app) newFlagSet(name string, cf *configFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	cf.bind(fs)
+	return fs
+}
+
+// loadConfig 按YAML配置文件、环境变量、命令行参数的顺序合并配置，并应用到kafkaex。
+func (a *app) loadConfig(cf *configFlags) (*config, error) {
+	cfg := &config{}
+	path := cf.path
+	if path == "" {
+		path = a.getenv("KAFKAEX_CONFIG")
+	}
+	if path != "" {
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(bs, cfg); err != nil {
+			return nil, err
+		}
+	}
+	pick := func(dst *string, env, flagValue string) {
+		if v := a.getenv(env); v != "" {
+			*dst = v
+		}
+		if flagValue != "" {
+			*dst = flagValue
+		}
+	}
+	brokers := strings.Join(cfg.Brokers, ",")
+	pick(&brokers, "KAFKAEX_BROKERS", cf.brokers)
+	cfg.Brokers = splitList(brokers)
+	pick(&cfg.User, "KAFKAEX_USER", cf.user)
+	pick(&cfg.Password, "KAFKAEX_PASSWORD", cf.password)
+	pick(&cfg.Name, "KAFKAEX_NAME", cf.name)
+	pick(&cfg.Store, "KAFKAEX_STORE", cf.store)
+
+	kafkaex.SetName(cfg.Name)
+	kafkaex.SetTopicNaming(cfg.Naming)
+	kafkaex.SetGetKafkaBrokersFunc(func() []string { return cfg.Brokers })
+	kafkaex.SetGetKafkaUserFunc(func() string { return cfg.User })
+	kafkaex.SetGetKafkaPwdFunc(func() string { return cfg.Password })
+	return cfg, nil
+}
+
+// openStore 根据配置打开死信存储，返回关闭函数。
+func openStore(cfg *config) (kafkaex.DeadLetterStore, func() error, error) {
+	kind, dsn, ok := strings.Cut(cfg.Store, ":")
+	if !ok || dsn == "" {
+		return nil, nil, fmt.Errorf("invalid store %q, want file:<dir> or sqlite:<dsn>", cfg.Store)
+	}
+	switch kind {
+	case "file":
+		s, err := kafkaex.NewFileDeadLetterStore(dsn)
+		return s, func() error { return nil }, err
+	case "sqlite":
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		s := kafkaex.NewSQLDeadLetterStore(db, kafkaex.DialectSQLite, "")
+		if err := s.Migrate(context.Background()); err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return s, db.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported store %q", kind)
+	}
+}
+
+// splitList 按逗号拆分并去除空白项。
+func splitList(s string) []string {
+	res := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// originFlags 可重复的topic:group参数，表示源订阅的主题与组别。
+type originFlags [][2]string
+
+// String 实现flag.Value接口。
+func (o *originFlags) String() string {
+	pairs := []string{}
+	for _, v := range *o {
+		pairs = append(pairs, v[0]+":"+v[1])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Set 实现flag.Value接口。
+func (o *originFlags) Set(s string) error {
+	topic, group, ok := strings.Cut(s, ":")
+	if !ok || topic == "" || group == "" {
+		return fmt.Errorf("invalid origin %q, want topic:group", s)
+	}
+	*o = append(*o, [2]string{topic, group})
+	return nil
+}
+
+// headerFlags 可重复的key=value参数。
+type headerFlags map[string]string
+
+// String 实现flag.Value接口。
+func (h headerFlags) String() string {
+	pairs := []string{}
+	for k, v := range h {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Set 实现flag.Value接口。
+func (h headerFlags) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("invalid header %q, want key=value", s)
+	}
+	h[k] = v
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/illidaris/watermillex/kafkaex"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockAdmin 记录创建主题的ClusterAdmin，未实现的方法调用时会panic。
+type mockAdmin struct {
+	sarama.ClusterAdmin
+	topics map[string]sarama.TopicDetail
+}
+
+func (m *mockAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	return m.topics, nil
+}
+
+func (m *mockAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+	m.topics[topic] = *detail
+	return nil
+}
+
+func (m *mockAdmin) Close() error {
+	return nil
+}
+
+func newTestApp(t *testing.T, stdin string) (*app, *bytes.Buffer, *mockAdmin) {
+	out := &bytes.Buffer{}
+	manager := kafkaex.NewMemoryManager()
+	admin := &mockAdmin{topics: map[string]sarama.TopicDetail{"orders": {}}}
+	env := map[string]string{"KAFKAEX_STORE": "file:" + filepath.Join(t.TempDir(), "dead")}
+	return &app{
+		stdin:  strings.NewReader(stdin),
+		stdout: out,
+		stderr: &bytes.Buffer{},
+		getenv: func(k string) string { return env[k] },
+		newManager: func(cfg *config) kafkaex.IManager {
+			return manager
+		},
+		newAdmin: func(cfg *config) (sarama.ClusterAdmin, error) {
+			return admin, nil
+		},
+		backlog: func(ctx context.Context, topic, group string) ([]*kafkaex.Backlog, error) {
+			return []*kafkaex.Backlog{
+				{Topic: topic, Group: group, Partition: 0, Newest: 10, Committed: 7, Lag: 3},
+				{Topic: topic, Group: group, Partition: 1, Newest: 5, Committed: 5, Lag: 0},
+			}, nil
+		},
+		openStore: openStore,
+	}, out, admin
+}
+
+func TestPublishConsume(t *testing.T) {
+	a, out, _ := newTestApp(t, `{"id":1}`)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	code := a.run(ctx, []string{"publish", "-topic", "orders", "-key", "k1", "-header", "event=created", "-retry-max", "3"})
+	assert.Equal(t, 0, code)
+	out.Reset()
+
+	code = a.run(ctx, []string{"consume", "-topic", "orders", "-count", "1"})
+	assert.Equal(t, 0, code)
+	v := &messageView{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), v))
+	assert.Equal(t, "orders", v.Topic)
+	assert.Equal(t, "k1", v.Key)
+	assert.Equal(t, int64(3), v.RetryMax)
+	assert.Equal(t, "created", v.Headers["event"])
+	assert.Equal(t, `{"id":1}`, v.Value)
+	assert.NotEmpty(t, v.PublishAt)
+}
+
+func TestPublishReservedHeader(t *testing.T) {
+	a, _, _ := newTestApp(t, "")
+	code := a.run(context.Background(), []string{"publish", "-topic", "orders", "-value", "x", "-header", kafkaex.APHMQH_MSG_TOPIC + "=x"})
+	assert.Equal(t, 1, code)
+}
+
+func TestDLQ(t *testing.T) {
+	a, out, _ := newTestApp(t, "")
+	ctx := context.Background()
+	cfg, err := a.loadConfig(&configFlags{})
+	assert.Nil(t, err)
+	store, _, err := openStore(cfg)
+	assert.Nil(t, err)
+	handle := kafkaex.NewDeadLetterHandle(store)
+	for _, id := range []string{"1", "2", "3"} {
+		box := kafkaex.NewBoxMessage().WithOption(kafkaex.WithTopic("orders"))
+		box.MsgId = id
+		box.ExecErr = "fail " + id
+		assert.Nil(t, handle(ctx, box))
+	}
+
+	assert.Equal(t, 0, a.run(ctx, []string{"dlq", "list", "-topic", "orders"}))
+	assert.Len(t, strings.Split(strings.TrimSpace(out.String()), "\n"), 3)
+	out.Reset()
+
+	assert.Equal(t, 0, a.run(ctx, []string{"dlq", "replay", "-id", "1", "-value", "fixed"}))
+	assert.Equal(t, "replayed 1\n", out.String())
+	out.Reset()
+
+	// 未指定条件时需要-all确认
+	assert.Equal(t, 2, a.run(ctx, []string{"dlq", "purge"}))
+	assert.Equal(t, 0, a.run(ctx, []string{"dlq", "purge", "-error", "fail 2"}))
+	assert.Equal(t, "purged 1\n", out.String())
+	out.Reset()
+
+	assert.Equal(t, 0, a.run(ctx, []string{"dlq", "replay", "-all"}))
+	assert.Equal(t, "replayed 1\n", out.String())
+}
+
+func TestRetryStats(t *testing.T) {
+	a, out, _ := newTestApp(t, "")
+	assert.Equal(t, 0, a.run(context.Background(), []string{"retry", "stats"}))
+	assert.Contains(t, out.String(), kafkaex.APHMQITP_RETRY)
+	assert.Regexp(t, `TOTAL\s+3`, out.String())
+}
+
+func TestRetryStatsNaming(t *testing.T) {
+	a, out, _ := newTestApp(t, "")
+	file := filepath.Join(t.TempDir(), "kafkaex.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte("naming:\n  retry: \"{topic}.retry\"\n  group: \"{group}.inner\"\n"), 0o644))
+	defer kafkaex.SetTopicNaming(kafkaex.TopicNaming{})
+	ctx := context.Background()
+	// 配置了命名模板时需要指定源订阅
+	assert.Equal(t, 2, a.run(ctx, []string{"retry", "stats", "-config", file}))
+	assert.Equal(t, 0, a.run(ctx, []string{"retry", "stats", "-config", file, "-origin", "orders:billing", "-origin", "users:billing"}))
+	assert.Contains(t, out.String(), "orders.retry  billing.inner")
+	assert.Contains(t, out.String(), "users.retry   billing.inner")
+	assert.Regexp(t, `TOTAL\s+6`, out.String())
+}
+
+func TestTopicsEnsure(t *testing.T) {
+	a, out, admin := newTestApp(t, "")
+	file := filepath.Join(t.TempDir(), "topics.yaml")
+	spec := `
+- name: orders
+  partitions: 3
+- name: payments
+  partitions: 6
+  replicationFactor: 3
+  configs:
+    retention.ms: "86400000"
+`
+	assert.Nil(t, os.WriteFile(file, []byte(spec), 0o644))
+	assert.Equal(t, 0, a.run(context.Background(), []string{"topics", "ensure", "-file", file}))
+	assert.Contains(t, out.String(), "created payments")
+	assert.Equal(t, int32(6), admin.topics["payments"].NumPartitions)
+	assert.Equal(t, "86400000", *admin.topics["payments"].ConfigEntries["retention.ms"])
+	assert.Contains(t, out.String(), "drift orders partitions want=3 got=0")
+}
+
+func TestConfigPriority(t *testing.T) {
+	a, _, _ := newTestApp(t, "")
+	file := filepath.Join(t.TempDir(), "kafkaex.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte("brokers: [yaml:9092]\nuser: yaml\npassword: yaml\n"), 0o644))
+	env := map[string]string{"KAFKAEX_CONFIG": file, "KAFKAEX_USER": "env"}
+	a.getenv = func(k string) string { return env[k] }
+
+	cfg, err := a.loadConfig(&configFlags{password: "flag"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"yaml:9092"}, cfg.Brokers)
+	assert.Equal(t, "env", cfg.User)
+	assert.Equal(t, "flag", cfg.Password)
+}
+
+func TestUsage(t *testing.T) {
+	a, _, _ := newTestApp(t, "")
+	assert.Equal(t, 2, a.run(context.Background(), nil))
+	assert.Equal(t, 2, a.run(context.Background(), []string{"unknown"}))
+	assert.Equal(t, 2, a.run(context.Background(), []string{"dlq", "unknown"}))
+	assert.Equal(t, 2, a.run(context.Background(), []string{"publish"}))
+}
@@ -0,0 +1,321 @@
+package kafkaex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"golang.org/x/time/rate"
+)
+
+// adminBulkMax 单次批量操作处理的最大死信数量。
+const adminBulkMax = 1000
+
+// AuditEntry 定义了一条管理操作的审计记录。
+type AuditEntry struct {
+	Action   string            `json:"action" form:"action"`     // 操作，如replay、bulk_replay、discard、purge、pause、resume、ratelimit
+	Operator string            `json:"operator" form:"operator"` // 操作人，取自X-Operator请求头，缺省为请求地址
+	Id       string            `json:"id" form:"id"`             // 单条操作的死信ID
+	Filter   *DeadLetterFilter `json:"filter" form:"filter"`     // 批量操作的检索条件
+	Topic    string            `json:"topic" form:"topic"`       // 订阅控制的主题
+	Group    string            `json:"group" form:"group"`       // 订阅控制的组别
+	Value    string            `json:"value" form:"value"`       // 设置的值，如限流的rps
+	Count    int64             `json:"count" form:"count"`       // 影响的数量
+	Err      string            `json:"err" form:"err"`           // 操作失败的原因
+	At       int64             `json:"at" form:"at"`             // 操作时间戳
+}
+
+// AdminOption 类型为函数，用于修改AdminHandler实例
+type AdminOption func(*AdminHandler)
+
+// WithAdminBacklog 设置重试积压的查询函数，默认使用管理器的RetryBacklog（如WaterMillManager），按命名模板查询各订阅的重试主题，否则查询共享的内置重试队列。
+func WithAdminBacklog(f func(ctx context.Context) ([]*Backlog, error)) AdminOption {
+	return func(h *AdminHandler) {
+		h.backlog = f
+	}
+}
+
+// WithAdminAudit 设置审计记录的处理函数，默认输出日志。
+func WithAdminAudit(f func(ctx context.Context, entry *AuditEntry)) AdminOption {
+	return func(h *AdminHandler) {
+		h.audit = f
+	}
+}
+
+// WithAdminSubscriptions 设置订阅的运行时控制，默认使用DeadLetters.Manager（实现了SubscriptionController时）。
+func WithAdminSubscriptions(c SubscriptionController) AdminOption {
+	return func(h *AdminHandler) {
+		h.subs = c
+	}
+}
+
+// WithAdminBulkLimit 设置批量操作的限流，every为令牌生成间隔，burst为突发数量。
+func WithAdminBulkLimit(every time.Duration, burst int) AdminOption {
+	return func(h *AdminHandler) {
+		h.limiter = rate.NewLimiter(rate.Every(every), burst)
+	}
+}
+
+// AdminHandler 死信与重试队列的HTTP管理接口，可挂载到任意路径下（配合http.StripPrefix）。
+//
+// 路由:
+// GET    /dead              按条件检索死信，参数topic、group、error、begin、end、offset、limit
+// GET    /dead/{id}         查看死信的完整信封
+// DELETE /dead/{id}         丢弃死信
+// POST   /dead/{id}/replay  重放死信，请求体可选{"value":"..."}修改消息值后重放
+// POST   /dead/replay       按条件批量重放，限流并审计
+// POST   /dead/purge        按条件批量丢弃，没有条件时需参数all=true，限流并审计
+// GET    /retry/backlog     查看重试队列积压
+// GET    /subscriptions            查看订阅状态
+// POST   /subscriptions/pause      暂停订阅，参数topic、group
+// POST   /subscriptions/resume     恢复订阅，参数topic、group
+// POST   /subscriptions/ratelimit  设置订阅限流，参数topic、group、rps，rps为0时取消限流
+type AdminHandler struct {
+	dead    *DeadLetters
+	subs    SubscriptionController
+	backlog func(ctx context.Context) ([]*Backlog, error)
+	audit   func(ctx context.Context, entry *AuditEntry)
+	limiter *rate.Limiter
+}
+
+// NewAdminHandler 创建并返回一个新的AdminHandler实例，默认每10秒允许一次批量操作。
+func NewAdminHandler(dead *DeadLetters, opts ...AdminOption) *AdminHandler {
+	h := &AdminHandler{
+		dead:    dead,
+		backlog: RetryBacklog,
+		audit:   defaultAudit,
+		limiter: rate.NewLimiter(rate.Every(10*time.Second), 1),
+	}
+	if c, ok := dead.Manager.(SubscriptionController); ok {
+		h.subs = c
+	}
+	if b, ok := dead.Manager.(interface {
+		RetryBacklog(ctx context.Context) ([]*Backlog, error)
+	}); ok {
+		h.backlog = b.RetryBacklog
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// adminResponse 管理接口统一的响应结构
+type adminResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data any    `json:"data,omitempty"`
+}
+
+// ServeHTTP 实现http.Handler接口。
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "dead" && r.Method == http.MethodGet:
+		h.list(w, r)
+	case len(parts) == 2 && parts[0] == "dead" && parts[1] == "replay" && r.Method == http.MethodPost:
+		h.bulkReplay(w, r)
+	case len(parts) == 2 && parts[0] == "dead" && parts[1] == "purge" && r.Method == http.MethodPost:
+		h.purge(w, r)
+	case len(parts) == 2 && parts[0] == "dead" && r.Method == http.MethodGet:
+		h.inspect(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "dead" && r.Method == http.MethodDelete:
+		h.discard(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "dead" && parts[2] == "replay" && r.Method == http.MethodPost:
+		h.replay(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "retry" && parts[1] == "backlog" && r.Method == http.MethodGet:
+		h.retryBacklog(w, r)
+	case len(parts) == 1 && parts[0] == "subscriptions" && r.Method == http.MethodGet && h.subs != nil:
+		writeAdmin(w, http.StatusOK, h.subs.Subscriptions(), nil)
+	case len(parts) == 2 && parts[0] == "subscriptions" && r.Method == http.MethodPost && h.subs != nil:
+		h.control(w, r, parts[1])
+	default:
+		writeAdmin(w, http.StatusNotFound, nil, errors.New("not found"))
+	}
+}
+
+// list 按条件检索死信。
+func (h *AdminHandler) list(w http.ResponseWriter, r *http.Request) {
+	dls, err := h.dead.List(r.Context(), parseDeadLetterFilter(r))
+	writeAdmin(w, http.StatusOK, dls, err)
+}
+
+// inspect 查看死信的完整信封。
+func (h *AdminHandler) inspect(w http.ResponseWriter, r *http.Request, id string) {
+	dl, err := h.dead.Inspect(r.Context(), id)
+	writeAdmin(w, http.StatusOK, dl, err)
+}
+
+// discard 丢弃单条死信。
+func (h *AdminHandler) discard(w http.ResponseWriter, r *http.Request, id string) {
+	count, err := h.dead.Store.Delete(r.Context(), id)
+	if err == nil && count == 0 {
+		err = ErrNoFoundDeadLetter
+	}
+	h.record(r, &AuditEntry{Action: "discard", Id: id, Count: count}, err)
+	writeAdmin(w, http.StatusOK, count, err)
+}
+
+// replay 重放单条死信，请求体中的value不为空时替换消息值。
+func (h *AdminHandler) replay(w http.ResponseWriter, r *http.Request, id string) {
+	var body struct {
+		Value *string `json:"value"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeAdmin(w, http.StatusBadRequest, nil, err)
+			return
+		}
+	}
+	var edit func(*BoxMessage) error
+	if body.Value != nil {
+		edit = func(box *BoxMessage) error {
+			box.Value = []byte(*body.Value)
+			return nil
+		}
+	}
+	err := h.dead.Replay(r.Context(), id, edit)
+	entry := &AuditEntry{Action: "replay", Id: id}
+	if err == nil {
+		entry.Count = 1
+	}
+	h.record(r, entry, err)
+	writeAdmin(w, http.StatusOK, entry.Count, err)
+}
+
+// bulkReplay 按条件批量重放死信。
+func (h *AdminHandler) bulkReplay(w http.ResponseWriter, r *http.Request) {
+	if !h.limiter.Allow() {
+		writeAdmin(w, http.StatusTooManyRequests, nil, errors.New("too many bulk operations"))
+		return
+	}
+	filter := parseDeadLetterFilter(r)
+	if filter.Limit <= 0 || filter.Limit > adminBulkMax {
+		filter.Limit = adminBulkMax
+	}
+	count, err := h.dead.ReplayFilter(r.Context(), filter)
+	h.record(r, &AuditEntry{Action: "bulk_replay", Filter: filter, Count: count}, err)
+	writeAdmin(w, http.StatusOK, count, err)
+}
+
+// purge 按条件批量丢弃死信，每次最多adminBulkMax条。没有任何条件时需设置all=true，避免误删全部死信。
+func (h *AdminHandler) purge(w http.ResponseWriter, r *http.Request) {
+	filter := parseDeadLetterFilter(r)
+	if filter.Topic == "" && filter.Group == "" && filter.Error == "" && filter.Begin == 0 && filter.End == 0 && !cast.ToBool(r.URL.Query().Get("all")) {
+		writeAdmin(w, http.StatusBadRequest, nil, errors.New("filter is required, set all=true to purge all"))
+		return
+	}
+	if !h.limiter.Allow() {
+		writeAdmin(w, http.StatusTooManyRequests, nil, errors.New("too many bulk operations"))
+		return
+	}
+	if filter.Limit <= 0 || filter.Limit > adminBulkMax {
+		filter.Limit = adminBulkMax
+	}
+	var count int64
+	dls, err := h.dead.List(r.Context(), filter)
+	if err == nil && len(dls) > 0 {
+		ids := make([]string, 0, len(dls))
+		for _, dl := range dls {
+			ids = append(ids, dl.Id)
+		}
+		count, err = h.dead.Store.Delete(r.Context(), ids...)
+	}
+	h.record(r, &AuditEntry{Action: "purge", Filter: filter, Count: count}, err)
+	writeAdmin(w, http.StatusOK, count, err)
+}
+
+// retryBacklog 查看重试队列积压。
+func (h *AdminHandler) retryBacklog(w http.ResponseWriter, r *http.Request) {
+	bs, err := h.backlog(r.Context())
+	writeAdmin(w, http.StatusOK, bs, err)
+}
+
+// control 暂停、恢复订阅或设置订阅限流。
+func (h *AdminHandler) control(w http.ResponseWriter, r *http.Request, action string) {
+	q := r.URL.Query()
+	topic, group := q.Get("topic"), q.Get("group")
+	if topic == "" || group == "" {
+		writeAdmin(w, http.StatusBadRequest, nil, errors.New("topic and group are required"))
+		return
+	}
+	entry := &AuditEntry{Action: action, Topic: topic, Group: group, Count: 1}
+	var err error
+	switch action {
+	case "pause":
+		err = h.subs.Pause(topic, group)
+	case "resume":
+		err = h.subs.Resume(topic, group)
+	case "ratelimit":
+		rps, err := cast.ToFloat64E(q.Get("rps"))
+		if err != nil {
+			writeAdmin(w, http.StatusBadRequest, nil, err)
+			return
+		}
+		entry.Value = q.Get("rps")
+		err = h.subs.SetRateLimit(topic, group, rps)
+	default:
+		writeAdmin(w, http.StatusNotFound, nil, errors.New("not found"))
+		return
+	}
+	if err != nil {
+		entry.Count = 0
+	}
+	h.record(r, entry, err)
+	writeAdmin(w, http.StatusOK, entry.Count, err)
+}
+
+// record 补全操作人、时间与错误信息后写入审计。
+func (h *AdminHandler) record(r *http.Request, entry *AuditEntry, err error) {
+	entry.Operator = r.Header.Get("X-Operator")
+	if entry.Operator == "" {
+		entry.Operator = r.RemoteAddr
+	}
+	entry.At = time.Now().Unix()
+	if err != nil {
+		entry.Err = err.Error()
+	}
+	h.audit(r.Context(), entry)
+}
+
+// defaultAudit 默认的审计处理，输出日志。
+func defaultAudit(ctx context.Context, entry *AuditEntry) {
+	bs, _ := json.Marshal(entry)
+	deflog.InfoCtx(ctx, "死信管理审计>>>%s", string(bs))
+}
+
+// parseDeadLetterFilter 从请求参数中解析检索条件。
+func parseDeadLetterFilter(r *http.Request) *DeadLetterFilter {
+	q := r.URL.Query()
+	return &DeadLetterFilter{
+		Topic:  q.Get("topic"),
+		Group:  q.Get("group"),
+		Error:  q.Get("error"),
+		Begin:  cast.ToInt64(q.Get("begin")),
+		End:    cast.ToInt64(q.Get("end")),
+		Offset: cast.ToInt(q.Get("offset")),
+		Limit:  cast.ToInt(q.Get("limit")),
+	}
+}
+
+// writeAdmin 输出JSON响应，存在错误时code为1，未找到死信或订阅时状态码为404。
+func writeAdmin(w http.ResponseWriter, status int, data any, err error) {
+	resp := &adminResponse{Data: data}
+	if err != nil {
+		resp.Code = 1
+		resp.Msg = err.Error()
+		resp.Data = nil
+		if errors.Is(err, ErrNoFoundDeadLetter) || errors.Is(err, ErrNoFoundSubscription) {
+			status = http.StatusNotFound
+		} else if status == http.StatusOK {
+			status = http.StatusInternalServerError
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
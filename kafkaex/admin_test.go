@@ -0,0 +1,115 @@
+package kafkaex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doAdmin(h http.Handler, method, target, body string) (*httptest.ResponseRecorder, *adminResponse) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("X-Operator", "oncall")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	resp := &adminResponse{}
+	_ = json.Unmarshal(rec.Body.Bytes(), resp)
+	return rec, resp
+}
+
+func TestAdminHandler(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	assert.Nil(t, err)
+	handle := NewDeadLetterHandle(store)
+	assert.Nil(t, handle(ctx, newDeadBox("1", "orders", "g1", "db timeout")))
+	assert.Nil(t, handle(ctx, newDeadBox("2", "orders", "g1", "invalid payload")))
+	assert.Nil(t, handle(ctx, newDeadBox("3", "users", "g2", "db timeout")))
+	assert.Nil(t, handle(ctx, newDeadBox("4", "users", "g2", "db timeout")))
+
+	m := newMockManager()
+	audits := []*AuditEntry{}
+	h := NewAdminHandler(NewDeadLetters(store, m),
+		WithAdminAudit(func(ctx context.Context, entry *AuditEntry) {
+			audits = append(audits, entry)
+		}),
+		WithAdminBacklog(func(ctx context.Context) ([]*Backlog, error) {
+			return []*Backlog{{Topic: APHMQITP_RETRY, Group: APHMQIGP_INNER, Lag: 5}}, nil
+		}),
+		WithAdminBulkLimit(time.Hour, 1),
+	)
+
+	rec, resp := doAdmin(h, http.MethodGet, "/dead?topic=orders", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, resp.Data, 2)
+
+	rec, _ = doAdmin(h, http.MethodGet, "/dead/2", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid payload")
+
+	rec, _ = doAdmin(h, http.MethodGet, "/dead/404", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec, _ = doAdmin(h, http.MethodPost, "/dead/2/replay", `{"value":"fixed"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []byte("fixed"), m.published["orders"][0].Value)
+
+	rec, _ = doAdmin(h, http.MethodDelete, "/dead/1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec, resp = doAdmin(h, http.MethodPost, "/dead/replay?topic=users", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(2), resp.Data)
+	assert.Len(t, m.published["users"], 2)
+
+	// 批量操作限流
+	rec, _ = doAdmin(h, http.MethodPost, "/dead/purge?topic=orders", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	rec, resp = doAdmin(h, http.MethodGet, "/retry/backlog", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, resp.Data, 1)
+
+	rec, _ = doAdmin(h, http.MethodPut, "/dead", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// 变更类操作均被审计
+	assert.Len(t, audits, 3)
+	assert.Equal(t, "replay", audits[0].Action)
+	assert.Equal(t, "oncall", audits[0].Operator)
+	assert.Equal(t, "discard", audits[1].Action)
+	assert.Equal(t, "bulk_replay", audits[2].Action)
+	assert.Equal(t, int64(2), audits[2].Count)
+	assert.Equal(t, "users", audits[2].Filter.Topic)
+}
+
+func TestAdminPurge(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	assert.Nil(t, err)
+	handle := NewDeadLetterHandle(store)
+	assert.Nil(t, handle(ctx, newDeadBox("1", "orders", "g1", "db timeout")))
+	assert.Nil(t, handle(ctx, newDeadBox("2", "orders", "g1", "invalid payload")))
+	assert.Nil(t, handle(ctx, newDeadBox("3", "users", "g2", "db timeout")))
+	h := NewAdminHandler(NewDeadLetters(store, newMockManager()), WithAdminBulkLimit(time.Millisecond, 10))
+
+	// 没有条件时拒绝
+	rec, _ := doAdmin(h, http.MethodPost, "/dead/purge", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, resp := doAdmin(h, http.MethodPost, "/dead/purge?error=db&limit=1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(1), resp.Data)
+
+	rec, resp = doAdmin(h, http.MethodPost, "/dead/purge?all=true", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(2), resp.Data)
+	dls, err := store.List(ctx, &DeadLetterFilter{})
+	assert.Nil(t, err)
+	assert.Len(t, dls, 0)
+}
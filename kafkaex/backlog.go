@@ -0,0 +1,127 @@
+package kafkaex
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+)
+
+// Backlog 定义了主题分区在消费组下的积压情况。
+type Backlog struct {
+	Topic     string `json:"topic" form:"topic"`         // 主题
+	Group     string `json:"group" form:"group"`         // 消费组
+	Partition int32  `json:"partition" form:"partition"` // 分区
+	Newest    int64  `json:"newest" form:"newest"`       // 分区最新偏移量(高水位)
+	Committed int64  `json:"committed" form:"committed"` // 消费组已提交的偏移量，未提交时为-1
+	Lag       int64  `json:"lag" form:"lag"`             // 积压数量
+}
+
+// GetBacklog 使用client计算主题在消费组下各分区的积压数量。
+func GetBacklog(client sarama.Client, topic, group string) ([]*Backlog, error) {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Backlog, 0, len(partitions))
+	for _, p := range partitions {
+		newest, err := client.GetOffset(topic, p, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		b := &Backlog{Topic: topic, Group: group, Partition: p, Newest: newest, Committed: -1}
+		if block := offsets.GetBlock(topic, p); block != nil {
+			b.Committed = block.Offset
+		}
+		b.Lag = newest
+		if b.Committed >= 0 {
+			b.Lag = newest - b.Committed
+		}
+		if b.Lag < 0 {
+			b.Lag = 0
+		}
+		res = append(res, b)
+	}
+	return res, nil
+}
+
+// TopicBacklog 连接Kafka计算主题在消费组下各分区的积压数量。
+func TopicBacklog(ctx context.Context, topic, group string) ([]*Backlog, error) {
+	client, err := sarama.NewClient(getKafkaBrokers(), getConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return GetBacklog(client, topic, group)
+}
+
+// RetryBacklog 计算共享的内置重试队列在内置消费组下各分区的积压数量，设置了重试主题的命名模板时使用WaterMillManager.RetryBacklog。
+func RetryBacklog(ctx context.Context) ([]*Backlog, error) {
+	return TopicBacklog(ctx, APHMQITP_RETRY, APHMQIGP_INNER)
+}
+
+// RetryBacklog 计算重试队列的积压数量。设置了重试主题的命名模板时，查询各已注册订阅对应的重试主题在其内置消费组下的积压，
+// 否则查询共享的内置重试主题。
+func (m *WaterMillManager) RetryBacklog(ctx context.Context) ([]*Backlog, error) {
+	client, err := sarama.NewClient(getKafkaBrokers(), getConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	res := []*Backlog{}
+	for _, t := range m.retryTargets() {
+		bs, err := GetBacklog(client, t.topic, t.group)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, bs...)
+	}
+	return res, nil
+}
+
+// retryTargets 返回需要查询积压的重试主题及其内置消费组，与registerInner的订阅一致，同一重试主题只取首个订阅的组别。
+func (m *WaterMillManager) retryTargets() []innerOrigin {
+	if defTopicNaming.Retry == "" {
+		return []innerOrigin{{topic: APHMQITP_RETRY, group: APHMQIGP_INNER}}
+	}
+	m.innerMu.Lock()
+	defer m.innerMu.Unlock()
+	seen := map[string]bool{}
+	res := []innerOrigin{}
+	for _, o := range m.innerOrigins {
+		topic := RetryTopic(o.topic, o.group)
+		if seen[topic] {
+			continue
+		}
+		seen[topic] = true
+		res = append(res, innerOrigin{topic: topic, group: InnerGroup(o.topic, o.group)})
+	}
+	return res
+}
+
+// TopicWatermarks 连接Kafka获取主题各分区的最新偏移量(高水位)。
+func TopicWatermarks(ctx context.Context, topic string) (map[int32]int64, error) {
+	client, err := sarama.NewClient(getKafkaBrokers(), getConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int32]int64, len(partitions))
+	for _, p := range partitions {
+		if res[p], err = client.GetOffset(topic, p, sarama.OffsetNewest); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
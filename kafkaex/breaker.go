@@ -0,0 +1,140 @@
+package kafkaex
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常消费
+	BreakerOpen     = "open"      // 熔断中，暂停消费
+	BreakerHalfOpen = "half-open" // 冷却结束，以一条消息探测
+)
+
+// CircuitBreaker 订阅的熔断器，最近window条消息的失败率达到threshold时熔断，暂停拉取消息，
+// 冷却cooldown后以当前消息探测，成功则恢复消费，失败则继续熔断。熔断期间消息保留在源主题，直到探测成功。
+// 通过WithBreakerProbes设置探测次数上限后，同一消息探测失败达到上限时按ErrExec进入重试与死信队列，冷却后以下一条消息探测，避免毒消息阻塞分区。
+type CircuitBreaker struct {
+	threshold float64
+	window    int
+	cooldown  time.Duration
+	probes    int // 同一消息的探测次数上限，默认为0不限制
+	mu        sync.Mutex
+	state     string
+	outcomes  []bool // 最近的处理结果，true为失败
+	next      int
+	failures  int
+	openedAt  time.Time
+}
+
+// BreakerOption 类型为函数，用于修改CircuitBreaker实例
+type BreakerOption func(*CircuitBreaker)
+
+// WithBreakerProbes 开启毒消息的处理：同一消息探测失败n次后进入重试与死信，继续以下一条消息探测。
+// 默认不限制，消息一直保留在源主题直到探测成功；依赖长时间故障时，超过上限的消息会逐条进入重试与死信，应结合冷却时长设置n。
+func WithBreakerProbes(n int) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.probes = n
+	}
+}
+
+// NewCircuitBreaker 创建并返回一个新的CircuitBreaker实例。
+// threshold: 失败率阈值，取值(0,1]。
+// window: 统计失败率的消息数量，消息数量不足window时不熔断。
+// cooldown: 熔断后探测前的等待时长。
+func NewCircuitBreaker(threshold float64, window int, cooldown time.Duration, opts ...BreakerOption) *CircuitBreaker {
+	if window < 1 {
+		window = 1
+	}
+	b := &CircuitBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+		outcomes:  make([]bool, 0, window),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// State 返回熔断器的状态。
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// hold 记录一条消息的处理结果，返回true表示已熔断，该消息需保留并在冷却后重新处理。
+func (b *CircuitBreaker) hold(err error) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerHalfOpen:
+		if err != nil {
+			b.open()
+			return true
+		}
+		b.state = BreakerClosed
+		b.outcomes, b.next, b.failures = b.outcomes[:0], 0, 0
+		return false
+	case BreakerOpen:
+		return true
+	}
+	b.record(err != nil)
+	if err != nil && len(b.outcomes) >= b.window && float64(b.failures)/float64(b.window) >= b.threshold {
+		b.open()
+		return true
+	}
+	return false
+}
+
+// exhausted 判断同一消息已探测probes次后是否达到上限。
+func (b *CircuitBreaker) exhausted(probes int) bool {
+	return b.probes > 0 && probes >= b.probes
+}
+
+// wait 等待冷却结束后进入探测状态，上下文结束时返回错误。
+func (b *CircuitBreaker) wait(ctx context.Context) error {
+	b.mu.Lock()
+	wait := b.cooldown - time.Since(b.openedAt)
+	b.mu.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	b.mu.Lock()
+	b.state = BreakerHalfOpen
+	b.mu.Unlock()
+	return nil
+}
+
+// open 进入熔断状态。
+func (b *CircuitBreaker) open() {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+}
+
+// record 将处理结果写入环形窗口。
+func (b *CircuitBreaker) record(failed bool) {
+	if len(b.outcomes) < b.window {
+		b.outcomes = append(b.outcomes, failed)
+	} else {
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+		b.outcomes[b.next] = failed
+	}
+	b.next = (b.next + 1) % b.window
+	if failed {
+		b.failures++
+	}
+}
@@ -0,0 +1,118 @@
+package kafkaex
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(0.5, 4, 10*time.Millisecond)
+	fail := errors.New("fail")
+	// 窗口未满时不熔断
+	assert.False(t, b.hold(fail))
+	assert.False(t, b.hold(fail))
+	assert.False(t, b.hold(nil))
+	// 窗口内失败率达到阈值时熔断
+	assert.True(t, b.hold(fail))
+	assert.Equal(t, BreakerOpen, b.State())
+
+	// 冷却后探测失败继续熔断
+	assert.Nil(t, b.wait(context.Background()))
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.True(t, b.hold(fail))
+	assert.Equal(t, BreakerOpen, b.State())
+
+	// 探测成功后恢复，并重新统计
+	assert.Nil(t, b.wait(context.Background()))
+	assert.False(t, b.hold(nil))
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.False(t, b.hold(fail))
+
+	// 默认不限制探测次数，消息保留直到探测成功
+	assert.False(t, b.exhausted(100))
+	assert.True(t, NewCircuitBreaker(0.5, 4, time.Millisecond, WithBreakerProbes(2)).exhausted(2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.open()
+	assert.ErrorIs(t, b.wait(ctx), context.Canceled)
+}
+
+func TestCircuitBreakerSubscription(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	var down atomic.Bool
+	down.Store(true)
+	got := make(chan string, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithGroup("g1"),
+		WithCircuitBreaker(1, 2, 50*time.Millisecond),
+		WithHandle(func(ctx context.Context, box *BoxMessage) error {
+			if down.Load() {
+				return errors.New("db down")
+			}
+			got <- string(box.Value)
+			return nil
+		})))
+	retries := make(chan string, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, APHMQITP_RETRY, WithGroup(APHMQIGP_INNER), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		retries <- string(box.Value)
+		return nil
+	})))
+
+	for _, v := range []string{"1", "2", "3"} {
+		box := NewBoxMessage().WithOption(WithRetryMax(3))
+		box.Value = []byte(v)
+		assert.Nil(t, m.Publish("orders", box))
+	}
+	assert.Eventually(t, func() bool {
+		return m.Subscriptions()[0].Breaker == BreakerOpen
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// 依赖恢复后以保留的消息探测并继续消费
+	down.Store(false)
+	consumed := []string{<-got, <-got}
+	assert.Equal(t, BreakerClosed, m.Subscriptions()[0].Breaker)
+	// 仅熔断前失败的消息进入重试队列，熔断时的消息保留后重新处理
+	retried := <-retries
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, append(consumed, retried))
+	assert.Len(t, retries, 0)
+}
+
+func TestCircuitBreakerPoisonMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	var attempts atomic.Int32
+	got := make(chan string, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithGroup("g1"),
+		WithCircuitBreaker(1, 1, 10*time.Millisecond, WithBreakerProbes(2)),
+		WithHandle(func(ctx context.Context, box *BoxMessage) error {
+			if string(box.Value) == "poison" {
+				attempts.Add(1)
+				return errors.New("invalid payload")
+			}
+			got <- string(box.Value)
+			return nil
+		})))
+	retries := make(chan string, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, APHMQITP_RETRY, WithGroup(APHMQIGP_INNER), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		retries <- string(box.Value)
+		return nil
+	})))
+
+	for _, v := range []string{"poison", "ok"} {
+		box := NewBoxMessage().WithOption(WithRetryMax(3))
+		box.Value = []byte(v)
+		assert.Nil(t, m.Publish("orders", box))
+	}
+	// 毒消息探测失败达到上限后进入重试，不再阻塞后续消息
+	assert.Equal(t, "poison", <-retries)
+	assert.Equal(t, "ok", <-got)
+	assert.Equal(t, int32(3), attempts.Load())
+}
@@ -0,0 +1,57 @@
+package kafkaex
+
+import "encoding/json"
+
+// defCodec 默认的消息体编解码器。
+var defCodec Codec = JSONCodec{}
+
+// Codec 定义了消息体的编解码接口，默认使用JSON。
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec 基于encoding/json的编解码器。
+type JSONCodec struct{}
+
+// Marshal 将v编码为JSON。
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal 将JSON解码到v。
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// SetCodec 设置消息体的编解码器，传入nil则恢复为JSON。
+func SetCodec(c Codec) {
+	if c == nil {
+		c = JSONCodec{}
+	}
+	defCodec = c
+}
+
+// Encode 使用配置的编解码器将v编码为消息体。
+func (m *BoxMessage) Encode(v any) error {
+	bs, err := defCodec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	m.Value = bs
+	return nil
+}
+
+// Decode 使用配置的编解码器将消息体解码到v。
+func (m *BoxMessage) Decode(v any) error {
+	return defCodec.Unmarshal(m.Value, v)
+}
+
+// NewEvent 创建并返回一个指定事件类型的消息，消息体由v编码。
+func NewEvent(eventType string, v any, opts ...Option) (*BoxMessage, error) {
+	box := NewBoxMessage().WithOption(append(opts, WithEventType(eventType))...)
+	if err := box.Encode(v); err != nil {
+		return nil, err
+	}
+	return box, nil
+}
@@ -15,6 +15,7 @@ var (
 	name            string                                 // 节点名
 	once            sync.Once                              // 确保全局变量只被初始化一次。
 	defManager      IManager                               // 默认的管理接口。
+	defManagerOpts  []ManagerOption                        // 创建默认管理器的选项。
 	deflog          ILogger         = NewWaterMillLogger() // 默认的日志记录器。
 	getKafkaUser    func() string                          // 获取Kafka的用户名的函数。
 	getKafkaPwd     func() string                          // 获取Kafka的密码的函数。
@@ -28,6 +29,11 @@ func SetName(n string) {
 	name = n
 }
 
+// SetManagerOptions 设置GetManager创建默认管理器的选项，如WithTopicProvision、WithScheduler，需在首次调用GetManager之前设置。
+func SetManagerOptions(opts ...ManagerOption) {
+	defManagerOpts = opts
+}
+
 // SetGetKafkaUserFunc 设置获取Kafka用户名的函数。
 func SetGetKafkaUserFunc(f func() string) {
 	getKafkaUser = f
@@ -100,19 +106,25 @@ func getConfig() *sarama.Config {
 	return saramaSubscriberConfig
 }
 
-// defaultRetryPublishHanle 消息重入真实消息队列 默认重试
-func defaultRetryPublishHandle(ctx context.Context, box *BoxMessage) error {
-	time.Sleep(getRetryDelay())
-	box.RetryIndex++ // 计数累加
-	deflog.InfoCtx(ctx, "消息%s重入%s,%s", box.MsgId, box.Topic, string(box.Value))
-	m := GetManager()
-	if m == nil {
-		return ErrNoFoundManager
+// newRetryPublishHandle 消息重入真实消息队列 默认重试，使用m发布
+func newRetryPublishHandle(m IManager) Handler {
+	return func(ctx context.Context, box *BoxMessage) error {
+		time.Sleep(getRetryDelay())
+		if box.Expired() {
+			handleExpired(ctx, box.Topic, box.ExecGroup, box, nil) // 等待重试期间过期，按源主题与组别记录
+			return nil
+		}
+		box.RetryIndex++     // 计数累加
+		box.WithContext(ctx) // 重入链路以重试消费为父级
+		deflog.InfoCtx(ctx, "消息%s重入%s,%s", box.MsgId, box.Topic, string(box.Value))
+		if m == nil {
+			return ErrNoFoundManager
+		}
+		return m.Publish(box.Topic, box)
 	}
-	return m.Publish(box.Topic, box)
 }
 
-// defaultDeadHandle 消息私信队列 默认死信
+// defaultDeadHandle 消息私信队列 默认死信，设置了死信存储时同时持久化
 func defaultDeadHandle(ctx context.Context, box *BoxMessage) error {
 	bs, err := json.Marshal(box)
 	if err != nil {
@@ -120,5 +132,8 @@ func defaultDeadHandle(ctx context.Context, box *BoxMessage) error {
 		return err
 	}
 	deflog.InfoCtx(ctx, "死信队列>>>输出：", string(bs))
+	if defDeadLetterStore != nil {
+		return NewDeadLetterHandle(defDeadLetterStore)(ctx, box)
+	}
 	return nil
 }
@@ -14,6 +14,7 @@ const (
 
 // 消息头metadata
 const (
+	APHMQH_PREFIX        = "_aphmqh_"           // APHMQH_PREFIX 内置消息头的保留前缀，用户自定义消息头不可使用
 	APHMQH_PARTITION_KEY = "_aphmqh_partition"  // APHMQH_PARTITION_KEY 用于标识消息所在的分区
 	APHMQH_TRACE_ID      = "_aphmqh_traceid"    // APHMQH_TRACE_ID 用于标识消息的跟踪ID
 	APHMQH_MSG_ID        = "_aphmqh_msgid"      // APHMQH_MSG_ID 用于唯一标识消息的ID
@@ -25,5 +26,14 @@ const (
 	APHMQH_EXECER        = "_aphmqh_execer"     // APHMQH_EXECER 用于标识执行消息的实体
 	APHMQH_EXECAT        = "_aphmqh_execat"     // APHMQH_EXECAT 用于标识消息执行的时间
 	APHMQH_EXECERR       = "_aphmqh_execerr"    // APHMQH_EXECERR 用于记录消息执行失败的原因
+	APHMQH_EXEC_GROUP    = "_aphmqh_execgp"     // APHMQH_EXEC_GROUP 用于记录消息执行失败的组别
 	APHMQH_EXEC_TIMEOUT  = "_aphmqh_timeout"    // APHMQH_EXEC_TIMEOUT 用于标识消息执行的超时时间
+	APHMQH_PUBLISH_AT    = "_aphmqh_pubat"      // APHMQH_PUBLISH_AT 用于标识消息发布的时间戳(毫秒)
+	APHMQH_DELIVER_AT    = "_aphmqh_deliverat"  // APHMQH_DELIVER_AT 用于标识延迟消息的投递时间戳(毫秒)
+	APHMQH_EXPIRE_AT     = "_aphmqh_expireat"   // APHMQH_EXPIRE_AT 用于标识消息的过期时间戳(毫秒)
+	APHMQH_CORRELATION   = "_aphmqh_corrid"     // APHMQH_CORRELATION 用于关联请求与响应的ID
+	APHMQH_REPLY_TO      = "_aphmqh_replyto"    // APHMQH_REPLY_TO 用于标识接收响应的主题
+	APHMQH_EVENT_TYPE    = "_aphmqh_evtype"     // APHMQH_EVENT_TYPE 用于标识消息的事件类型
+	APHMQH_SAGA_ID       = "_aphmqh_sagaid"     // APHMQH_SAGA_ID 用于标识消息所属的Saga实例
+	APHMQH_META_PREFIX   = "_aphmqh_meta_"      // APHMQH_META_PREFIX 用于标识透传的上下文键值，后接上下文键名
 )
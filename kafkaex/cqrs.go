@@ -0,0 +1,165 @@
+package kafkaex
+
+import (
+	"context"
+	"reflect"
+	"strings"
+)
+
+// defCQRSNaming 命令与事件的命名模板。
+var defCQRSNaming = CQRSNaming{
+	CommandTopic: "commands.{name}",
+	EventTopic:   "events.{name}",
+	CommandGroup: "{service}.{name}",
+	EventGroup:   "{service}.{handler}",
+}
+
+// CQRSNaming 定义了命令与事件的主题及处理组别的命名模板，支持{name}（类型名）与{service}（节点名）占位符，组别模板还支持{handler}（事件处理程序名）。
+// 事件主题不含{name}时多个事件共用一个主题，按事件类型分发。
+type CQRSNaming struct {
+	CommandTopic string // 命令主题模板，默认commands.{name}
+	EventTopic   string // 事件主题模板，默认events.{name}
+	CommandGroup string // 命令处理组别模板，默认{service}.{name}，每个命令仅由一个服务处理
+	EventGroup   string // 事件处理组别模板，默认{service}.{handler}，每个处理程序各自收到全部事件
+}
+
+// SetCQRSNaming 设置命令与事件的命名模板，为空的字段保持默认值。主题模板不能使用{handler}，
+// 发布时没有处理程序名，否则发布与订阅的主题不一致，此时返回ErrInvalidNaming且不做修改。
+func SetCQRSNaming(n CQRSNaming) error {
+	if strings.Contains(n.CommandTopic, "{handler}") || strings.Contains(n.EventTopic, "{handler}") {
+		return ErrInvalidNaming
+	}
+	if n.CommandTopic != "" {
+		defCQRSNaming.CommandTopic = n.CommandTopic
+	}
+	if n.EventTopic != "" {
+		defCQRSNaming.EventTopic = n.EventTopic
+	}
+	if n.CommandGroup != "" {
+		defCQRSNaming.CommandGroup = n.CommandGroup
+	}
+	if n.EventGroup != "" {
+		defCQRSNaming.EventGroup = n.EventGroup
+	}
+	return nil
+}
+
+// MessageName 返回命令或事件的名称，实现了MessageName() string时使用其返回值，否则为类型名。
+func MessageName(v any) string {
+	if n, ok := v.(interface{ MessageName() string }); ok {
+		return n.MessageName()
+	}
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.Name()
+}
+
+// renderCQRSName 使用类型名与处理程序名替换模板中的占位符。
+func renderCQRSName(tpl, name, handler string) string {
+	return strings.NewReplacer("{name}", name, "{handler}", handler, "{service}", getName()).Replace(tpl)
+}
+
+// CommandBus 命令总线，命令按类型名发布到各自的主题，由一个服务处理。
+// 通过HandleCommand注册的处理程序在Start时按主题与组别订阅，同一主题与组别共用一个订阅。
+type CommandBus struct {
+	m        IManager
+	handlers eventHandlers
+}
+
+// NewCommandBus 创建并返回一个新的CommandBus实例。
+func NewCommandBus(m IManager) *CommandBus {
+	return &CommandBus{m: m}
+}
+
+// Topic 返回命令对应的主题。
+func (b *CommandBus) Topic(cmd any) string {
+	return renderCQRSName(defCQRSNaming.CommandTopic, MessageName(cmd), "")
+}
+
+// Send 使用配置的编解码器编码命令并发布，事件类型为命令名。
+func (b *CommandBus) Send(ctx context.Context, cmd any, opts ...Option) error {
+	box, err := NewEvent(MessageName(cmd), cmd, opts...)
+	if err != nil {
+		return err
+	}
+	box.WithContext(ctx)
+	return b.m.Publish(b.Topic(cmd), box)
+}
+
+// HandleCommand 注册命令T的处理程序，消息解码为T后交给h，处理失败按ErrExec进入重试与死信，需在Start之前注册。
+func HandleCommand[T any](b *CommandBus, h func(ctx context.Context, box *BoxMessage, cmd *T) error, opts ...Option) error {
+	name := MessageName(new(T))
+	topic := renderCQRSName(defCQRSNaming.CommandTopic, name, "")
+	group := renderCQRSName(defCQRSNaming.CommandGroup, name, "")
+	return handleCQRS(&b.handlers, topic, name, Typed(h), append([]Option{WithGroup(group)}, opts...)...)
+}
+
+// Start 订阅已注册命令的主题并开始消费，已开始的订阅跳过，订阅失败时可再次调用。
+func (b *CommandBus) Start(ctx context.Context) error {
+	return b.handlers.start(ctx, b.m)
+}
+
+// EventHandlers 返回通过HandleCommand注册的全部订阅及其命令类型，按主题与组别排序。
+func (b *CommandBus) EventHandlers() []*EventHandlers {
+	return b.handlers.list()
+}
+
+// EventBus 事件总线，事件按类型名发布，每个处理程序以独立的组别订阅。
+// 通过HandleEvent注册的处理程序在Start时按主题与组别订阅，同一主题与组别共用一个订阅。
+type EventBus struct {
+	m        IManager
+	handlers eventHandlers
+}
+
+// NewEventBus 创建并返回一个新的EventBus实例。
+func NewEventBus(m IManager) *EventBus {
+	return &EventBus{m: m}
+}
+
+// Topic 返回事件对应的主题。
+func (b *EventBus) Topic(event any) string {
+	return renderCQRSName(defCQRSNaming.EventTopic, MessageName(event), "")
+}
+
+// Publish 使用配置的编解码器编码事件并发布，事件类型为事件名。
+func (b *EventBus) Publish(ctx context.Context, event any, opts ...Option) error {
+	box, err := NewEvent(MessageName(event), event, opts...)
+	if err != nil {
+		return err
+	}
+	box.WithContext(ctx)
+	return b.m.Publish(b.Topic(event), box)
+}
+
+// HandleEvent 以处理程序名handler注册事件T的处理程序，同一处理程序名的多个实例共同消费，不同处理程序各自收到全部事件，需在Start之前注册。
+func HandleEvent[T any](b *EventBus, handler string, h func(ctx context.Context, box *BoxMessage, event *T) error, opts ...Option) error {
+	name := MessageName(new(T))
+	topic := renderCQRSName(defCQRSNaming.EventTopic, name, "")
+	group := renderCQRSName(defCQRSNaming.EventGroup, name, handler)
+	return handleCQRS(&b.handlers, topic, name, Typed(h), append([]Option{WithGroup(group)}, opts...)...)
+}
+
+// Start 订阅已注册事件的主题并开始消费，已开始的订阅跳过，订阅失败时可再次调用。
+func (b *EventBus) Start(ctx context.Context) error {
+	return b.handlers.start(ctx, b.m)
+}
+
+// EventHandlers 返回通过HandleEvent注册的全部订阅及其事件类型，按主题与组别排序。
+func (b *EventBus) EventHandlers() []*EventHandlers {
+	return b.handlers.list()
+}
+
+// handleCQRS 在主题与组别的订阅上为类型注册处理程序，未匹配的类型确认后跳过。
+func handleCQRS(handlers *eventHandlers, topic, name string, h Handler, opts ...Option) error {
+	router, err := handlers.route(topic, opts...)
+	if err != nil {
+		return err
+	}
+	router.Route(name, h)
+	return nil
+}
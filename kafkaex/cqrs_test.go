@@ -0,0 +1,119 @@
+package kafkaex
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type placeOrder struct {
+	Id string `json:"id"`
+}
+
+type orderPlaced struct {
+	Id string `json:"id"`
+}
+
+type orderShipped struct {
+	Id string `json:"id"`
+}
+
+func (orderShipped) MessageName() string {
+	return "order.shipped"
+}
+
+func TestMessageName(t *testing.T) {
+	assert.Equal(t, "placeOrder", MessageName(placeOrder{}))
+	assert.Equal(t, "placeOrder", MessageName(&placeOrder{}))
+	assert.Equal(t, "order.shipped", MessageName(&orderShipped{}))
+	assert.Equal(t, "", MessageName(nil))
+}
+
+func TestCommandBus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	bus := NewCommandBus(m)
+	assert.Equal(t, "commands.placeOrder", bus.Topic(&placeOrder{}))
+	got := make(chan string, 10)
+	assert.Nil(t, HandleCommand(bus, func(ctx context.Context, box *BoxMessage, cmd *placeOrder) error {
+		if cmd.Id == "bad" {
+			return errors.New("out of stock")
+		}
+		got <- cmd.Id
+		return nil
+	}))
+	assert.Nil(t, bus.Start(ctx))
+	retries := make(chan *BoxMessage, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, APHMQITP_RETRY, WithGroup(APHMQIGP_INNER), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		retries <- box
+		return nil
+	})))
+
+	assert.Nil(t, bus.Send(ctx, &placeOrder{Id: "o1"}))
+	assert.Nil(t, bus.Send(ctx, &placeOrder{Id: "bad"}, WithRetryMax(3)))
+	assert.Equal(t, "o1", <-got)
+	// 处理失败仍按ErrExec进入重试队列
+	retried := <-retries
+	assert.Equal(t, "commands.placeOrder", retried.Topic)
+	assert.Equal(t, "kafkaex.placeOrder", retried.ExecGroup)
+	assert.Equal(t, "out of stock", retried.ExecErr)
+}
+
+func TestEventBus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.Equal(t, ErrInvalidNaming, SetCQRSNaming(CQRSNaming{EventTopic: "events.{handler}"}))
+	assert.Nil(t, SetCQRSNaming(CQRSNaming{EventTopic: "events"}))
+	defer SetCQRSNaming(CQRSNaming{EventTopic: "events.{name}"})
+	m := NewMemoryManager().(*WaterMillManager)
+	bus := NewEventBus(m)
+	got := make(chan string, 10)
+	for _, handler := range []string{"mailer", "billing"} {
+		handler := handler
+		assert.Nil(t, HandleEvent(bus, handler, func(ctx context.Context, box *BoxMessage, evt *orderPlaced) error {
+			got <- handler + ":placed:" + evt.Id
+			return nil
+		}))
+	}
+	assert.Nil(t, HandleEvent(bus, "mailer", func(ctx context.Context, box *BoxMessage, evt *orderShipped) error {
+		got <- "mailer:shipped:" + evt.Id
+		return nil
+	}))
+	assert.Nil(t, bus.Start(ctx))
+
+	assert.Nil(t, bus.Publish(ctx, &orderPlaced{Id: "o1"}))
+	assert.Nil(t, bus.Publish(ctx, &orderShipped{Id: "o1"}))
+	assert.ElementsMatch(t, []string{"mailer:placed:o1", "billing:placed:o1", "mailer:shipped:o1"}, []string{<-got, <-got, <-got})
+	// 共用事件主题时每个处理程序一个订阅，按事件类型分发
+	assert.Equal(t, []*EventHandlers{
+		{Topic: "events", Group: "kafkaex.billing", EventTypes: []string{"orderPlaced"}},
+		{Topic: "events", Group: "kafkaex.mailer", EventTypes: []string{"order.shipped", "orderPlaced"}},
+	}, bus.EventHandlers())
+}
+
+func TestEventBusWithAnyManager(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	bus := NewEventBus(&mockSubscriberOnly{IManager: m})
+	got := make(chan string, 10)
+	// Start之前发布的事件在处理程序注册后再消费
+	assert.Nil(t, bus.Publish(ctx, &orderPlaced{Id: "o2"}))
+	assert.Nil(t, HandleEvent(bus, "audit", func(ctx context.Context, box *BoxMessage, evt *orderPlaced) error {
+		got <- evt.Id
+		return nil
+	}))
+	assert.Nil(t, bus.Start(ctx))
+	assert.Equal(t, "o2", <-got)
+	assert.Equal(t, ErrHandlersStarted, HandleEvent(bus, "audit", func(ctx context.Context, box *BoxMessage, evt *orderPlaced) error {
+		return nil
+	}))
+}
+
+// mockSubscriberOnly 仅实现IManager的管理器。
+type mockSubscriberOnly struct {
+	IManager
+}
@@ -0,0 +1,191 @@
+package kafkaex
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// defDeadLetterStore 默认的死信存储，设置后默认死信处理函数会将死信持久化。
+var defDeadLetterStore DeadLetterStore
+
+// SetDeadLetterStore 设置默认的死信存储。
+func SetDeadLetterStore(s DeadLetterStore) {
+	defDeadLetterStore = s
+}
+
+// DeadLetter 定义了一条持久化的死信，包括用于检索的字段与完整的消息信封。
+type DeadLetter struct {
+	Id     string      `json:"id" form:"id"`         // 死信ID
+	Topic  string      `json:"topic" form:"topic"`   // 源主题
+	Group  string      `json:"group" form:"group"`   // 消费失败的组别
+	Error  string      `json:"error" form:"error"`   // 执行错误信息
+	DeadAt int64       `json:"deadat" form:"deadat"` // 进入死信的时间戳
+	Box    *BoxMessage `json:"box" form:"box"`       // 完整的消息信封，包括消息头与消息值
+}
+
+// NewDeadLetter 根据BoxMessage创建一条死信，消息ID为空时生成新的ID，组别为消费失败的组别。
+func NewDeadLetter(box *BoxMessage) *DeadLetter {
+	id := box.MsgId
+	if id == "" {
+		id = watermill.NewUUID()
+	}
+	return &DeadLetter{
+		Id:     id,
+		Topic:  box.Topic,
+		Group:  execGroup(box),
+		Error:  box.ExecErr,
+		DeadAt: time.Now().Unix(),
+		Box:    box,
+	}
+}
+
+// execGroup 返回消息消费失败的组别，未记录时为发布的组别。
+func execGroup(box *BoxMessage) string {
+	if box.ExecGroup != "" {
+		return box.ExecGroup
+	}
+	return box.Group
+}
+
+// DeadLetterFilter 定义了死信的检索条件，零值字段表示不过滤。
+type DeadLetterFilter struct {
+	Topic  string `json:"topic" form:"topic"`   // 源主题
+	Group  string `json:"group" form:"group"`   // 消费失败的组别
+	Error  string `json:"error" form:"error"`   // 错误信息包含的内容
+	Begin  int64  `json:"begin" form:"begin"`   // 进入死信的起始时间戳(含)
+	End    int64  `json:"end" form:"end"`       // 进入死信的结束时间戳(不含)
+	Offset int    `json:"offset" form:"offset"` // 分页偏移量
+	Limit  int    `json:"limit" form:"limit"`   // 分页大小，0表示不限制
+}
+
+// Match 判断死信是否满足检索条件，不考虑分页。
+func (f *DeadLetterFilter) Match(d *DeadLetter) bool {
+	if f.Topic != "" && f.Topic != d.Topic {
+		return false
+	}
+	if f.Group != "" && f.Group != d.Group {
+		return false
+	}
+	if f.Error != "" && !strings.Contains(d.Error, f.Error) {
+		return false
+	}
+	if f.Begin > 0 && d.DeadAt < f.Begin {
+		return false
+	}
+	if f.End > 0 && d.DeadAt >= f.End {
+		return false
+	}
+	return true
+}
+
+// DeadLetterStore 定义了死信存储的接口，包括保存、检索、查看与删除。
+type DeadLetterStore interface {
+	Save(ctx context.Context, d *DeadLetter) error
+	List(ctx context.Context, filter *DeadLetterFilter) ([]*DeadLetter, error)
+	Get(ctx context.Context, id string) (*DeadLetter, error)
+	Delete(ctx context.Context, ids ...string) (int64, error)
+	Purge(ctx context.Context, filter *DeadLetterFilter) (int64, error)
+}
+
+// NewDeadLetterHandle 创建一个将死信持久化到存储的处理函数，可用于RegisterDead。
+// 持久化失败时输出完整的信封日志并返回nil：死信消费失败会重新发布到同一死信主题，存储故障期间将形成循环。
+func NewDeadLetterHandle(store DeadLetterStore) Handler {
+	return func(ctx context.Context, box *BoxMessage) error {
+		if err := store.Save(ctx, NewDeadLetter(box)); err != nil {
+			bs, _ := json.Marshal(box)
+			deflog.ErrorCtx(ctx, "死信%s持久化失败%v>>>%s", box.MsgId, err, string(bs))
+		}
+		return nil
+	}
+}
+
+// DeadLetters 提供死信的检索、查看、重放与清理。
+type DeadLetters struct {
+	Store   DeadLetterStore // 死信存储
+	Manager IManager        // 重放使用的消息管理器
+}
+
+// NewDeadLetters 创建并返回一个新的DeadLetters实例，manager为nil时使用默认管理器。
+func NewDeadLetters(store DeadLetterStore, manager IManager) *DeadLetters {
+	if manager == nil {
+		manager = GetManager()
+	}
+	return &DeadLetters{Store: store, Manager: manager}
+}
+
+// List 按条件检索死信。
+func (d *DeadLetters) List(ctx context.Context, filter *DeadLetterFilter) ([]*DeadLetter, error) {
+	if filter == nil {
+		filter = &DeadLetterFilter{}
+	}
+	return d.Store.List(ctx, filter)
+}
+
+// Inspect 查看单条死信的完整信封。
+func (d *DeadLetters) Inspect(ctx context.Context, id string) (*DeadLetter, error) {
+	return d.Store.Get(ctx, id)
+}
+
+// Replay 将死信重放到源主题，edit不为nil时可在重放前修改消息，重放成功后删除死信。
+func (d *DeadLetters) Replay(ctx context.Context, id string, edit func(*BoxMessage) error) error {
+	dl, err := d.Store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if edit != nil {
+		if err := edit(dl.Box); err != nil {
+			return err
+		}
+	}
+	if err := d.replay(ctx, dl); err != nil {
+		return err
+	}
+	_, err = d.Store.Delete(ctx, dl.Id)
+	return err
+}
+
+// ReplayFilter 将满足条件的死信全部重放到源主题，返回重放成功的数量，遇到错误时立即停止。
+func (d *DeadLetters) ReplayFilter(ctx context.Context, filter *DeadLetterFilter) (int64, error) {
+	dls, err := d.List(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, dl := range dls {
+		if err := d.replay(ctx, dl); err != nil {
+			return count, err
+		}
+		if _, err := d.Store.Delete(ctx, dl.Id); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Purge 删除满足条件的死信，返回删除的数量。
+func (d *DeadLetters) Purge(ctx context.Context, filter *DeadLetterFilter) (int64, error) {
+	if filter == nil {
+		filter = &DeadLetterFilter{}
+	}
+	return d.Store.Purge(ctx, filter)
+}
+
+// replay 重置重试状态并将消息发布到源主题。
+func (d *DeadLetters) replay(ctx context.Context, dl *DeadLetter) error {
+	box := dl.Box
+	if box == nil || box.Topic == "" {
+		return ErrNoFoundTopic
+	}
+	box.RetryIndex = 0
+	box.Execer = ""
+	box.ExecAt = 0
+	box.ExecErr = ""
+	box.WithContext(ctx)
+	deflog.InfoCtx(ctx, "死信%s重放至%s", dl.Id, box.Topic)
+	return d.Manager.Publish(box.Topic, box)
+}
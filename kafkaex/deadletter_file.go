@@ -0,0 +1,157 @@
+package kafkaex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileDeadLetterStore 基于文件的死信存储，每条死信保存为目录下的一个JSON文件，适用于死信量较小的场景。
+type FileDeadLetterStore struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+// NewFileDeadLetterStore 创建并返回一个新的FileDeadLetterStore实例，目录不存在时自动创建。
+func NewFileDeadLetterStore(dir string) (*FileDeadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileDeadLetterStore{dir: dir}, nil
+}
+
+// Save 保存一条死信，ID已存在时覆盖。
+func (s *FileDeadLetterStore) Save(ctx context.Context, d *DeadLetter) error {
+	bs, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp := s.path(d.Id) + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(d.Id))
+}
+
+// List 按条件检索死信，按进入死信的时间倒序排列。
+func (s *FileDeadLetterStore) List(ctx context.Context, filter *DeadLetterFilter) ([]*DeadLetter, error) {
+	s.mu.RLock()
+	all, err := s.all()
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	res := []*DeadLetter{}
+	for _, d := range all {
+		if filter.Match(d) {
+			res = append(res, d)
+		}
+	}
+	if filter.Offset >= len(res) {
+		return []*DeadLetter{}, nil
+	}
+	res = res[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(res) {
+		res = res[:filter.Limit]
+	}
+	return res, nil
+}
+
+// Get 根据ID获取一条死信，不存在时返回ErrNoFoundDeadLetter。
+func (s *FileDeadLetterStore) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.read(s.path(id))
+}
+
+// Delete 根据ID删除死信，返回删除的数量。
+func (s *FileDeadLetterStore) Delete(ctx context.Context, ids ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	for _, id := range ids {
+		err := os.Remove(s.path(id))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Purge 删除满足条件的死信，忽略分页，返回删除的数量。
+func (s *FileDeadLetterStore) Purge(ctx context.Context, filter *DeadLetterFilter) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.all()
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, d := range all {
+		if !filter.Match(d) {
+			continue
+		}
+		if err := os.Remove(s.path(d.Id)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// path 返回死信对应的文件路径，ID中的路径分隔符会被替换。
+func (s *FileDeadLetterStore) path(id string) string {
+	id = strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(id)
+	return filepath.Join(s.dir, id+".json")
+}
+
+// read 读取单个死信文件。
+func (s *FileDeadLetterStore) read(path string) (*DeadLetter, error) {
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoFoundDeadLetter
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := &DeadLetter{}
+	if err := json.Unmarshal(bs, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// all 读取目录下全部死信，按进入死信的时间倒序排列。
+func (s *FileDeadLetterStore) all() ([]*DeadLetter, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*DeadLetter, 0, len(paths))
+	for _, p := range paths {
+		d, err := s.read(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].DeadAt == res[j].DeadAt {
+			return res[i].Id < res[j].Id
+		}
+		return res[i].DeadAt > res[j].DeadAt
+	})
+	return res, nil
+}
@@ -0,0 +1,214 @@
+package kafkaex
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SQL方言，决定占位符的格式
+const (
+	DialectSQLite   = "sqlite"   // DialectSQLite 使用?作为占位符
+	DialectPostgres = "postgres" // DialectPostgres 使用$n作为占位符
+)
+
+// SQLDeadLetterStore 基于database/sql的死信存储，支持SQLite与Postgres，驱动由调用方引入。
+type SQLDeadLetterStore struct {
+	db      *sql.DB
+	dialect string
+	table   string
+}
+
+// NewSQLDeadLetterStore 创建并返回一个新的SQLDeadLetterStore实例，table为空时使用kafkaex_dead_letter。
+func NewSQLDeadLetterStore(db *sql.DB, dialect, table string) *SQLDeadLetterStore {
+	if table == "" {
+		table = "kafkaex_dead_letter"
+	}
+	return &SQLDeadLetterStore{db: db, dialect: dialect, table: table}
+}
+
+// Migrate 创建死信表及索引，表已存在时不做处理。ID可能为外部消息的主题-分区-偏移量，长度上限为255。
+func (s *SQLDeadLetterStore) Migrate(ctx context.Context) error {
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(255) PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	group_name VARCHAR(255) NOT NULL,
+	exec_err TEXT NOT NULL,
+	dead_at BIGINT NOT NULL,
+	box TEXT NOT NULL
+)`, s.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_topic ON %s (topic, dead_at)", s.table, s.table),
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save 保存一条死信，ID已存在时覆盖。
+func (s *SQLDeadLetterStore) Save(ctx context.Context, d *DeadLetter) error {
+	bs, err := json.Marshal(d.Box)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (id, topic, group_name, exec_err, dead_at, box) VALUES (%s)
+ON CONFLICT (id) DO UPDATE SET topic = excluded.topic, group_name = excluded.group_name,
+exec_err = excluded.exec_err, dead_at = excluded.dead_at, box = excluded.box`,
+		s.table, s.placeholders(1, 6))
+	_, err = s.db.ExecContext(ctx, query, d.Id, d.Topic, d.Group, d.Error, d.DeadAt, string(bs))
+	return err
+}
+
+// List 按条件检索死信，按进入死信的时间倒序排列。
+func (s *SQLDeadLetterStore) List(ctx context.Context, filter *DeadLetterFilter) ([]*DeadLetter, error) {
+	where, args := s.where(filter)
+	query := fmt.Sprintf("SELECT id, topic, group_name, exec_err, dead_at, box FROM %s%s ORDER BY dead_at DESC, id",
+		s.table, where)
+	switch {
+	case filter.Limit > 0:
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", filter.Limit, filter.Offset)
+	case filter.Offset > 0 && s.dialect == DialectPostgres:
+		query += fmt.Sprintf(" OFFSET %d", filter.Offset)
+	case filter.Offset > 0:
+		query += fmt.Sprintf(" LIMIT -1 OFFSET %d", filter.Offset) // SQLite的OFFSET需要LIMIT，-1表示不限制
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []*DeadLetter{}
+	for rows.Next() {
+		d, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// Get 根据ID获取一条死信，不存在时返回ErrNoFoundDeadLetter。
+func (s *SQLDeadLetterStore) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	query := fmt.Sprintf("SELECT id, topic, group_name, exec_err, dead_at, box FROM %s WHERE id = %s",
+		s.table, s.placeholder(1))
+	d, err := scanDeadLetter(s.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoFoundDeadLetter
+	}
+	return d, err
+}
+
+// Delete 根据ID删除死信，返回删除的数量。
+func (s *SQLDeadLetterStore) Delete(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", s.table, s.placeholders(1, len(ids)))
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Purge 删除满足条件的死信，忽略分页，返回删除的数量。
+func (s *SQLDeadLetterStore) Purge(ctx context.Context, filter *DeadLetterFilter) (int64, error) {
+	where, args := s.where(filter)
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s%s", s.table, where), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// sqlLikeEscaper 转义LIKE的通配符，配合ESCAPE '\'按字面匹配。
+var sqlLikeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// where 根据检索条件生成WHERE子句与参数。
+func (s *SQLDeadLetterStore) where(filter *DeadLetterFilter) (string, []any) {
+	conds := []string{}
+	args := []any{}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, s.placeholder(len(args))))
+	}
+	if filter.Topic != "" {
+		add("topic = %s", filter.Topic)
+	}
+	if filter.Group != "" {
+		add("group_name = %s", filter.Group)
+	}
+	if filter.Error != "" {
+		add(`exec_err LIKE %s ESCAPE '\'`, "%"+sqlLikeEscaper.Replace(filter.Error)+"%")
+	}
+	if filter.Begin > 0 {
+		add("dead_at >= %s", filter.Begin)
+	}
+	if filter.End > 0 {
+		add("dead_at < %s", filter.End)
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// placeholder 返回第n个参数的占位符。
+func (s *SQLDeadLetterStore) placeholder(n int) string {
+	return sqlPlaceholder(s.dialect, n)
+}
+
+// placeholders 返回从第from个参数开始的count个占位符，以逗号分隔。
+func (s *SQLDeadLetterStore) placeholders(from, count int) string {
+	return sqlPlaceholders(s.dialect, from, count)
+}
+
+// sqlPlaceholder 按方言返回第n个参数的占位符。
+func sqlPlaceholder(dialect string, n int) string {
+	if dialect == DialectPostgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// sqlBinaryType 按方言返回二进制列的类型。
+func sqlBinaryType(dialect string) string {
+	if dialect == DialectPostgres {
+		return "BYTEA"
+	}
+	return "BLOB"
+}
+
+// sqlPlaceholders 按方言返回从第from个参数开始的count个占位符，以逗号分隔。
+func sqlPlaceholders(dialect string, from, count int) string {
+	ps := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		ps = append(ps, sqlPlaceholder(dialect, from+i))
+	}
+	return strings.Join(ps, ", ")
+}
+
+// scanDeadLetter 从查询结果中读取一条死信。
+func scanDeadLetter(row interface{ Scan(...any) error }) (*DeadLetter, error) {
+	d := &DeadLetter{}
+	var box string
+	if err := row.Scan(&d.Id, &d.Topic, &d.Group, &d.Error, &d.DeadAt, &box); err != nil {
+		return nil, err
+	}
+	d.Box = &BoxMessage{}
+	if err := json.Unmarshal([]byte(box), d.Box); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,218 @@
+package kafkaex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+// mockManager 记录发布消息的IManager实现，用于测试。
+type mockManager struct {
+	published map[string][]*BoxMessage
+}
+
+func newMockManager() *mockManager {
+	return &mockManager{published: map[string][]*BoxMessage{}}
+}
+
+func (m *mockManager) Publish(topic string, box *BoxMessage) error {
+	m.published[topic] = append(m.published[topic], box)
+	return nil
+}
+
+func (m *mockManager) RawPublish(topic string, box *BoxMessage, ow func(*sarama.Config) *sarama.Config) error {
+	return m.Publish(topic, box)
+}
+
+func (m *mockManager) RegisterSubscriber(ctx context.Context, topic string, opts ...Option) error {
+	return nil
+}
+
+func (m *mockManager) RegisterRetry(ctx context.Context, h Handler) error {
+	return nil
+}
+
+func (m *mockManager) RegisterDead(ctx context.Context, h Handler) error {
+	return nil
+}
+
+func newDeadBox(id, topic, group, execErr string) *BoxMessage {
+	box := NewBoxMessage().WithOption(WithTopic(topic), WithGroup(group), WithRetryMax(3), WithRetryIndex(3))
+	box.MsgId = id
+	box.Value = []byte("payload-" + id)
+	box.ExecErr = execErr
+	_ = box.SetHeader("event-type", "order.created")
+	return box
+}
+
+func testDeadLetterStore(t *testing.T, store DeadLetterStore) {
+	ctx := context.Background()
+	handle := NewDeadLetterHandle(store)
+	assert.Nil(t, handle(ctx, newDeadBox("1", "orders", "g1", "db timeout")))
+	assert.Nil(t, handle(ctx, newDeadBox("2", "orders", "g2", "invalid payload")))
+	assert.Nil(t, handle(ctx, newDeadBox("3", "users", "g1", "db timeout")))
+
+	dls, err := store.List(ctx, &DeadLetterFilter{})
+	assert.Nil(t, err)
+	assert.Len(t, dls, 3)
+
+	dls, err = store.List(ctx, &DeadLetterFilter{Topic: "orders"})
+	assert.Nil(t, err)
+	assert.Len(t, dls, 2)
+
+	dls, err = store.List(ctx, &DeadLetterFilter{Group: "g1", Error: "timeout"})
+	assert.Nil(t, err)
+	assert.Len(t, dls, 2)
+
+	dls, err = store.List(ctx, &DeadLetterFilter{Begin: 1, End: 2})
+	assert.Nil(t, err)
+	assert.Len(t, dls, 0)
+
+	dls, err = store.List(ctx, &DeadLetterFilter{Offset: 1, Limit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, dls, 1)
+
+	// 未设置数量时仅跳过offset条
+	dls, err = store.List(ctx, &DeadLetterFilter{Offset: 1})
+	assert.Nil(t, err)
+	assert.Len(t, dls, 2)
+
+	dl, err := store.Get(ctx, "2")
+	assert.Nil(t, err)
+	assert.Equal(t, "invalid payload", dl.Error)
+	assert.Equal(t, "order.created", dl.Box.GetHeader("event-type"))
+	assert.Equal(t, []byte("payload-2"), dl.Box.Value)
+
+	_, err = store.Get(ctx, "404")
+	assert.Equal(t, ErrNoFoundDeadLetter, err)
+
+	// 修改后重放到源主题，成功后删除
+	m := newMockManager()
+	dead := NewDeadLetters(store, m)
+	err = dead.Replay(ctx, "2", func(box *BoxMessage) error {
+		box.Value = []byte("fixed")
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Len(t, m.published["orders"], 1)
+	replayed := m.published["orders"][0]
+	assert.Equal(t, []byte("fixed"), replayed.Value)
+	assert.Equal(t, int64(0), replayed.RetryIndex)
+	assert.Equal(t, "", replayed.ExecErr)
+	_, err = store.Get(ctx, "2")
+	assert.Equal(t, ErrNoFoundDeadLetter, err)
+
+	// 编辑失败时不重放
+	editErr := errors.New("edit")
+	assert.Equal(t, editErr, dead.Replay(ctx, "1", func(*BoxMessage) error { return editErr }))
+
+	count, err := dead.ReplayFilter(ctx, &DeadLetterFilter{Topic: "users"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Len(t, m.published["users"], 1)
+
+	count, err = dead.Purge(ctx, &DeadLetterFilter{Error: "timeout"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	dls, err = dead.List(ctx, nil)
+	assert.Nil(t, err)
+	assert.Len(t, dls, 0)
+}
+
+func TestFileDeadLetterStore(t *testing.T) {
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	assert.Nil(t, err)
+	testDeadLetterStore(t, store)
+}
+
+func TestSQLDeadLetterStore(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	store := NewSQLDeadLetterStore(db, DialectSQLite, "")
+	assert.Nil(t, store.Migrate(context.Background()))
+	testDeadLetterStore(t, store)
+}
+
+func TestSQLDeadLetterStorePostgresPlaceholder(t *testing.T) {
+	store := NewSQLDeadLetterStore(nil, DialectPostgres, "")
+	where, args := store.where(&DeadLetterFilter{Topic: "orders", Begin: 1})
+	assert.Equal(t, " WHERE topic = $1 AND dead_at >= $2", where)
+	assert.Len(t, args, 2)
+	assert.Equal(t, "$1, $2, $3", store.placeholders(1, 3))
+}
+
+func TestErrExecSetTopic(t *testing.T) {
+	var got string
+	box := NewBoxMessage().WithOption(WithRetryMax(1))
+	_ = ErrExec("orders", "execer", box, errors.New("fail"), func(topic string, box *BoxMessage) error {
+		got = topic
+		return nil
+	})
+	assert.Equal(t, APHMQITP_RETRY, got)
+	assert.Equal(t, "orders", box.Topic)
+}
+
+// failingDeadLetterStore 保存死信总是失败的存储。
+type failingDeadLetterStore struct {
+	DeadLetterStore
+}
+
+func (failingDeadLetterStore) Save(ctx context.Context, d *DeadLetter) error {
+	return errors.New("db down")
+}
+
+func TestDeadLetterHandleSaveError(t *testing.T) {
+	// 持久化失败时不返回错误，避免死信重新发布到死信主题
+	assert.Nil(t, NewDeadLetterHandle(failingDeadLetterStore{})(context.Background(), newDeadBox("1", "orders", "g1", "db timeout")))
+}
+
+func TestNewDeadLetterExecGroup(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	assert.Nil(t, err)
+	// 发布的组别与消费失败的组别不同时，按消费失败的组别记录
+	box := newDeadBox("1", "orders", "producer", "db timeout")
+	box.ExecGroup = "billing"
+	assert.Nil(t, NewDeadLetterHandle(store)(ctx, box))
+	assert.Nil(t, NewDeadLetterHandle(store)(ctx, newDeadBox("2", "orders", "producer", "db timeout")))
+
+	dls, err := store.List(ctx, &DeadLetterFilter{Group: "billing"})
+	assert.Nil(t, err)
+	assert.Len(t, dls, 1)
+	assert.Equal(t, "1", dls[0].Id)
+	dls, err = store.List(ctx, &DeadLetterFilter{Group: "producer"})
+	assert.Nil(t, err)
+	assert.Len(t, dls, 1)
+	assert.Equal(t, "2", dls[0].Id)
+}
+
+func TestSQLDeadLetterStoreErrorLiteral(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	store := NewSQLDeadLetterStore(db, DialectSQLite, "")
+	assert.Nil(t, store.Migrate(ctx))
+	handle := NewDeadLetterHandle(store)
+	assert.Nil(t, handle(ctx, newDeadBox("1", "orders", "g1", "disk 100% full")))
+	assert.Nil(t, handle(ctx, newDeadBox("2", "orders", "g1", "disk 1000 full")))
+	assert.Nil(t, handle(ctx, newDeadBox("3", "orders", "g1", "missing user_id")))
+	assert.Nil(t, handle(ctx, newDeadBox("4", "orders", "g1", "missing userXid")))
+
+	// 通配符按字面匹配
+	for q, id := range map[string]string{"100%": "1", "user_id": "3"} {
+		dls, err := store.List(ctx, &DeadLetterFilter{Error: q})
+		assert.Nil(t, err)
+		assert.Len(t, dls, 1)
+		assert.Equal(t, id, dls[0].Id)
+	}
+}
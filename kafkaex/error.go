@@ -9,11 +9,37 @@ import "errors"
 // - 没有配置主题
 // - 没有配置组名
 // - 没有配置执行函数
+// - 消息头使用了保留前缀
+// - 没有找到死信
+// - 没有配置延迟调度器
+// - 没有找到延迟消息
+// - 消息已过期
+// - 请求处理失败
+// - 没有订阅响应主题
+// - 订阅已开始消费
+// - 命名模板无效
+// - 没有找到Saga实例
+// - Saga实例已被修改
+// - Table已启动
+// - 没有找到订阅
 var (
-	ErrNoFoundManager    = errors.New("没有配置管理器")  // 表示没有找到配置的理器
-	ErrNoFoundPublisher  = errors.New("没有配置发布者")  // 表示没有找到配置的发布者
-	ErrNoFoundSubscriber = errors.New("没有配置订阅者")  // 表示没有找到配置的订阅者
-	ErrNoFoundTopic      = errors.New("没有配置主题")   // 表示没有找到配置的主题
-	ErrNoFoundGroup      = errors.New("没有配置组名")   // 表示没有找到配置的组名
-	ErrNoFoundHandle     = errors.New("没有配置执行函数") // 表示没有找到配置的执行函数
+	ErrNoFoundManager      = errors.New("没有配置管理器")    // 表示没有找到配置的理器
+	ErrNoFoundPublisher    = errors.New("没有配置发布者")    // 表示没有找到配置的发布者
+	ErrNoFoundSubscriber   = errors.New("没有配置订阅者")    // 表示没有找到配置的订阅者
+	ErrNoFoundTopic        = errors.New("没有配置主题")     // 表示没有找到配置的主题
+	ErrNoFoundGroup        = errors.New("没有配置组名")     // 表示没有找到配置的组名
+	ErrNoFoundHandle       = errors.New("没有配置执行函数")   // 表示没有找到配置的执行函数
+	ErrReservedHeader      = errors.New("消息头使用了保留前缀") // 表示自定义消息头使用了内置的保留前缀
+	ErrNoFoundDeadLetter   = errors.New("没有找到死信")     // 表示没有找到指定的死信
+	ErrNoFoundScheduler    = errors.New("没有配置延迟调度器")  // 表示发布延迟消息时没有配置调度器
+	ErrNoFoundSchedule     = errors.New("没有找到延迟消息")   // 表示没有找到指定的延迟消息，可能已投递或已取消
+	ErrExpired             = errors.New("消息已过期")      // 表示消息在处理前已过期
+	ErrRemote              = errors.New("请求处理失败")     // 表示响应方处理请求失败
+	ErrNoFoundReplies      = errors.New("没有订阅响应主题")   // 表示发送请求前没有调用StartReplies订阅响应主题
+	ErrHandlersStarted     = errors.New("订阅已开始消费")    // 表示订阅已通过StartHandlers开始消费，不能再注册处理程序
+	ErrInvalidNaming       = errors.New("命名模板无效")     // 表示命名模板使用了不支持的占位符
+	ErrNoFoundSaga         = errors.New("没有找到Saga实例") // 表示没有找到指定的Saga实例
+	ErrSagaConflict        = errors.New("Saga实例已被修改") // 表示保存Saga状态时版本不一致，实例已被并发修改
+	ErrTableStarted        = errors.New("Table已启动")   // 表示Table已开始读取，不能重复调用Start
+	ErrNoFoundSubscription = errors.New("没有找到订阅")     // 表示主题在消费组下没有注册过订阅，无法暂停、恢复或限流
 )
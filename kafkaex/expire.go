@@ -0,0 +1,41 @@
+package kafkaex
+
+import "context"
+
+// defExpiredHandle 默认的过期消息处理函数，为nil时丢弃。
+var defExpiredHandle Handler
+
+// SetExpiredHandle 设置默认的过期消息处理函数，订阅未配置WithExpiredHandle以及重试消费时使用，传入nil则丢弃。
+func SetExpiredHandle(h Handler) {
+	defExpiredHandle = h
+}
+
+// ExpiredDrop 丢弃过期消息，仅输出日志。
+func ExpiredDrop(ctx context.Context, box *BoxMessage) error {
+	deflog.InfoCtx(ctx, "消息%s已过期，丢弃%s", box.MsgId, box.Topic)
+	return nil
+}
+
+// ExpiredToDead 将过期消息发送到源主题对应的死信主题，执行错误记为ErrExpired。
+func ExpiredToDead(m IManager) Handler {
+	return func(ctx context.Context, box *BoxMessage) error {
+		box.ExecResult(getName(), ErrExpired)
+		box.WithContext(ctx)
+		getMetrics().ObserveDead(box.Topic)
+		return m.Publish(DeadTopic(box.Topic, box.ExecGroup), box)
+	}
+}
+
+// handleExpired 记录过期指标并交给过期消息处理函数，h为nil时使用默认配置。
+func handleExpired(ctx context.Context, topic, group string, box *BoxMessage, h Handler) {
+	getMetrics().ObserveExpired(topic, group)
+	if h == nil {
+		h = defExpiredHandle
+	}
+	if h == nil {
+		h = ExpiredDrop
+	}
+	if err := h(ctx, box); err != nil {
+		deflog.ErrorCtx(ctx, "处理过期消息%s失败%v", box.MsgId, err)
+	}
+}
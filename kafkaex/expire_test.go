@@ -0,0 +1,103 @@
+package kafkaex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoxMessageExpired(t *testing.T) {
+	assert.False(t, NewBoxMessage().Expired())
+	assert.False(t, NewBoxMessage().WithOption(WithTTL(time.Minute)).Expired())
+	assert.True(t, NewBoxMessage().WithOption(WithExpireAt(time.Now().Add(-time.Second))).Expired())
+
+	// 过期时间随消息头传递
+	box := NewBoxMessage().WithOption(WithTTL(time.Minute))
+	got := NewBoxMessage().WithRawMessage(box.NewRawMessage())
+	assert.Equal(t, box.ExpireAt, got.ExpireAt)
+}
+
+func TestExpiredSubscription(t *testing.T) {
+	metrics := NewMetrics("")
+	assert.Nil(t, metrics.Register(prometheus.NewRegistry()))
+	SetMetrics(metrics)
+	defer SetMetrics(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := NewMemoryManager()
+	handled := make(chan string, 10)
+	expired := make(chan *BoxMessage, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, "quotes", WithGroup("g1"),
+		WithExpiredHandle(func(ctx context.Context, box *BoxMessage) error {
+			expired <- box
+			return nil
+		}),
+		WithHandle(func(ctx context.Context, box *BoxMessage) error {
+			handled <- string(box.Value)
+			return nil
+		})))
+
+	stale := NewBoxMessage().WithOption(WithExpireAt(time.Now().Add(-time.Second)))
+	stale.Value = []byte("stale")
+	assert.Nil(t, m.Publish("quotes", stale))
+	select {
+	case box := <-expired:
+		assert.Equal(t, "stale", string(box.Value))
+		assert.Equal(t, "quotes", box.Topic)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for expired message")
+	}
+	fresh := NewBoxMessage().WithOption(WithTTL(time.Minute))
+	fresh.Value = []byte("fresh")
+	assert.Nil(t, m.Publish("quotes", fresh))
+	assert.Equal(t, "fresh", <-handled)
+	assert.Len(t, handled, 0)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ExpiredTotal.WithLabelValues("quotes", "g1")))
+}
+
+func TestExpiredToDead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	dead := make(chan *BoxMessage, 1)
+	assert.Nil(t, m.RegisterDead(ctx, func(ctx context.Context, box *BoxMessage) error {
+		dead <- box
+		return nil
+	}))
+	assert.Nil(t, m.RegisterSubscriber(ctx, "otp", WithGroup("g1"), WithExpiredHandle(ExpiredToDead(m)), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		return nil
+	})))
+
+	// 死信主题中的过期消息仍交给死信处理
+	assert.Nil(t, m.Publish("otp", NewBoxMessage().WithOption(WithExpireAt(time.Now().Add(-time.Second)))))
+	select {
+	case box := <-dead:
+		assert.Equal(t, "otp", box.Topic)
+		assert.Equal(t, "g1", box.ExecGroup)
+		assert.Equal(t, ErrExpired.Error(), box.ExecErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for expired dead letter")
+	}
+}
+
+func TestRetryExpired(t *testing.T) {
+	SetRetryDelay(time.Millisecond)
+	defer SetRetryDelay(0)
+	dropped := []*BoxMessage{}
+	SetExpiredHandle(func(ctx context.Context, box *BoxMessage) error {
+		dropped = append(dropped, box)
+		return nil
+	})
+	defer SetExpiredHandle(nil)
+	m := newMockManager()
+	box := newDeadBox("1", "orders", "g1", "fail")
+	box.ExpireAt = time.Now().Add(-time.Second).UnixMilli()
+	assert.Nil(t, newRetryPublishHandle(m)(context.Background(), box))
+	assert.Len(t, dropped, 1)
+	assert.Len(t, m.published["orders"], 0)
+}
@@ -0,0 +1,136 @@
+package kafkaex
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HeaderEquals 匹配自定义消息头等于value的消息。
+func HeaderEquals(name, value string) func(box *BoxMessage) bool {
+	return func(box *BoxMessage) bool {
+		return box.GetHeader(name) == value
+	}
+}
+
+// HeaderIn 匹配自定义消息头为values之一的消息。
+func HeaderIn(name string, values ...string) func(box *BoxMessage) bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return func(box *BoxMessage) bool {
+		return set[box.GetHeader(name)]
+	}
+}
+
+// HeaderPrefix 匹配自定义消息头以prefix开头的消息。
+func HeaderPrefix(name, prefix string) func(box *BoxMessage) bool {
+	return func(box *BoxMessage) bool {
+		return strings.HasPrefix(box.GetHeader(name), prefix)
+	}
+}
+
+// EventTypeIn 匹配事件类型为types之一的消息。
+func EventTypeIn(types ...string) func(box *BoxMessage) bool {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[t] = true
+	}
+	return func(box *BoxMessage) bool {
+		return set[box.EventType]
+	}
+}
+
+// WithHeaderEquals 订阅仅处理自定义消息头等于value的消息
+func WithHeaderEquals(name, value string) Option {
+	return WithFilter(HeaderEquals(name, value))
+}
+
+// WithHeaderIn 订阅仅处理自定义消息头为values之一的消息
+func WithHeaderIn(name string, values ...string) Option {
+	return WithFilter(HeaderIn(name, values...))
+}
+
+// WithHeaderPrefix 订阅仅处理自定义消息头以prefix开头的消息
+func WithHeaderPrefix(name, prefix string) Option {
+	return WithFilter(HeaderPrefix(name, prefix))
+}
+
+// WithEventTypes 订阅仅处理指定事件类型的消息
+func WithEventTypes(types ...string) Option {
+	return WithFilter(EventTypeIn(types...))
+}
+
+// EventRouter 按事件类型将消息分发到不同的处理程序，通过WithHandle(router.Handle)注册到订阅。
+// 未匹配且没有兜底处理程序的消息直接确认，不计为失败，计入过滤指标。
+type EventRouter struct {
+	key      func(box *BoxMessage) string
+	mu       sync.RWMutex
+	routes   map[string]Handler
+	fallback Handler
+}
+
+// NewEventRouter 创建并返回一个新的EventRouter实例，key返回消息的路由键，为nil时使用消息的事件类型，如RouteByHeader("type")。
+func NewEventRouter(key func(box *BoxMessage) string) *EventRouter {
+	if key == nil {
+		key = RouteByEventType
+	}
+	return &EventRouter{key: key, routes: map[string]Handler{}}
+}
+
+// Route 为事件类型注册处理程序，重复注册时覆盖。
+func (r *EventRouter) Route(eventType string, h Handler) *EventRouter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[eventType] = h
+	return r
+}
+
+// Fallback 设置未匹配任何事件类型时的兜底处理程序。
+func (r *EventRouter) Fallback(h Handler) *EventRouter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = h
+	return r
+}
+
+// Types 返回已注册的事件类型，按名称排序，以及是否设置了兜底处理程序。
+func (r *EventRouter) Types() ([]string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.routes))
+	for t := range r.routes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types, r.fallback != nil
+}
+
+// Handle 按路由键分发消息，实现Handler。
+func (r *EventRouter) Handle(ctx context.Context, box *BoxMessage) error {
+	r.mu.RLock()
+	h, ok := r.routes[r.key(box)]
+	if !ok {
+		h = r.fallback
+	}
+	r.mu.RUnlock()
+	if h == nil {
+		getMetrics().ObserveFiltered(box.Topic, box.ExecGroup)
+		return nil
+	}
+	return h(ctx, box)
+}
+
+// RouteByEventType 以消息的事件类型作为路由键。
+func RouteByEventType(box *BoxMessage) string {
+	return box.EventType
+}
+
+// RouteByHeader 以自定义消息头作为路由键，用于外部生产者的消息。
+func RouteByHeader(name string) func(box *BoxMessage) string {
+	return func(box *BoxMessage) string {
+		return box.GetHeader(name)
+	}
+}
@@ -0,0 +1,103 @@
+package kafkaex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderMatchers(t *testing.T) {
+	box := NewBoxMessage()
+	assert.Nil(t, box.SetHeader("region", "eu-west"))
+	assert.True(t, HeaderEquals("region", "eu-west")(box))
+	assert.False(t, HeaderEquals("region", "eu")(box))
+	assert.True(t, HeaderIn("region", "us", "eu-west")(box))
+	assert.False(t, HeaderIn("region", "us")(box))
+	assert.True(t, HeaderPrefix("region", "eu-")(box))
+	assert.False(t, HeaderPrefix("tenant", "eu-")(box))
+
+	// 多个过滤条件需全部满足
+	opt := NewOptions(WithHeaderPrefix("region", "eu"), WithEventTypes("created"))
+	assert.False(t, opt.Filter(box))
+	box.EventType = "created"
+	assert.True(t, opt.Filter(box))
+}
+
+func TestSubscriptionFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	metrics := NewMetrics("filter")
+	SetMetrics(metrics)
+	defer SetMetrics(nil)
+	m := NewMemoryManager()
+	got := make(chan string, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, "events", WithGroup("g1"),
+		WithHeaderIn("tenant", "a", "b"),
+		WithHandle(func(ctx context.Context, box *BoxMessage) error {
+			got <- string(box.Value)
+			return nil
+		})))
+
+	for _, tenant := range []string{"a", "c", "b"} {
+		box := NewBoxMessage()
+		box.Value = []byte(tenant)
+		assert.Nil(t, box.SetHeader("tenant", tenant))
+		assert.Nil(t, m.Publish("events", box))
+	}
+	assert.ElementsMatch(t, []string{"a", "b"}, []string{<-got, <-got})
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.FilteredTotal.WithLabelValues("events", "g1")) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.ConsumeErrors.WithLabelValues("events", "g1")))
+}
+
+func TestEventRouter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	metrics := NewMetrics("router")
+	SetMetrics(metrics)
+	defer SetMetrics(nil)
+	m := NewMemoryManager()
+	got := make(chan string, 10)
+	router := NewEventRouter(nil).
+		Route("created", func(ctx context.Context, box *BoxMessage) error {
+			got <- "created:" + string(box.Value)
+			return nil
+		}).
+		Route("deleted", func(ctx context.Context, box *BoxMessage) error {
+			got <- "deleted:" + string(box.Value)
+			return nil
+		})
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithGroup("g1"), WithHandle(router.Handle)))
+
+	for _, evt := range []string{"created", "updated", "deleted"} {
+		box := NewBoxMessage().WithOption(WithEventType(evt))
+		box.Value = []byte("1")
+		assert.Nil(t, m.Publish("orders", box))
+	}
+	assert.ElementsMatch(t, []string{"created:1", "deleted:1"}, []string{<-got, <-got})
+	// 未匹配的消息直接确认并计入过滤指标
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.FilteredTotal.WithLabelValues("orders", "g1")) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// 设置兜底处理程序后处理未匹配的消息
+	box := NewBoxMessage().WithOption(WithEventType("archived"))
+	router.Fallback(func(ctx context.Context, box *BoxMessage) error {
+		got <- "fallback:" + box.EventType
+		return nil
+	})
+	assert.Nil(t, router.Handle(ctx, box))
+	assert.Equal(t, "fallback:archived", <-got)
+
+	byHeader := NewEventRouter(RouteByHeader("type")).Route("ping", func(ctx context.Context, box *BoxMessage) error {
+		got <- "ping"
+		return nil
+	})
+	assert.Nil(t, box.SetHeader("type", "ping"))
+	assert.Nil(t, byHeader.Handle(ctx, box))
+	assert.Equal(t, "ping", <-got)
+}
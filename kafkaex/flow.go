@@ -0,0 +1,136 @@
+package kafkaex
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// SubscriptionController 定义了订阅的运行时控制，WaterMillManager实现了该接口。
+type SubscriptionController interface {
+	Subscriptions() []*SubscriptionStatus
+	Pause(topic, group string) error
+	Resume(topic, group string) error
+	SetRateLimit(topic, group string, rps float64) error
+}
+
+// flowControl 订阅的暂停与限流状态，消费协程在处理每条消息前等待放行。
+type flowControl struct {
+	mu      sync.Mutex
+	paused  bool
+	resume  chan struct{}
+	rps     float64
+	limiter *rate.Limiter
+}
+
+// wait 等待暂停结束并获取限流令牌，上下文结束时返回错误。
+// 等待期间不读取后续消息，消费组的心跳由订阅者维持，不会触发重平衡。
+func (f *flowControl) wait(ctx context.Context) error {
+	for {
+		f.mu.Lock()
+		paused, resume, limiter := f.paused, f.resume, f.limiter
+		f.mu.Unlock()
+		if paused {
+			select {
+			case <-resume:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if limiter != nil {
+			return limiter.Wait(ctx)
+		}
+		return nil
+	}
+}
+
+// Pause 暂停主题在消费组下的消费，已在处理的消息会处理完成。主题在消费组下没有订阅时返回ErrNoFoundSubscription。
+func (m *WaterMillManager) Pause(topic, group string) error {
+	if !m.subscribed(topic, group) {
+		return ErrNoFoundSubscription
+	}
+	f := m.flow(topic, group)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.paused {
+		f.paused = true
+		f.resume = make(chan struct{})
+	}
+	return nil
+}
+
+// Resume 恢复主题在消费组下的消费，主题在消费组下没有订阅时返回ErrNoFoundSubscription。
+func (m *WaterMillManager) Resume(topic, group string) error {
+	if !m.subscribed(topic, group) {
+		return ErrNoFoundSubscription
+	}
+	f := m.flow(topic, group)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.paused {
+		f.paused = false
+		close(f.resume)
+	}
+	return nil
+}
+
+// SetRateLimit 设置主题在消费组下每秒处理的消息数量，rps小于等于0时取消限流，主题在消费组下没有订阅时返回ErrNoFoundSubscription。
+// 注册订阅时的限流使用WithRateLimit。
+func (m *WaterMillManager) SetRateLimit(topic, group string, rps float64) error {
+	if !m.subscribed(topic, group) {
+		return ErrNoFoundSubscription
+	}
+	f := m.flow(topic, group)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rps = rps
+	f.limiter = nil
+	if rps > 0 {
+		burst := int(rps)
+		if burst < 1 {
+			burst = 1
+		}
+		f.limiter = rate.NewLimiter(rate.Limit(rps), burst)
+	}
+	return nil
+}
+
+// subscribed 判断主题在消费组下是否注册过订阅。
+func (m *WaterMillManager) subscribed(topic, group string) bool {
+	m.statusMu.RLock()
+	defer m.statusMu.RUnlock()
+	for _, s := range m.statuses {
+		if s.Topic == topic && s.Group == group {
+			return true
+		}
+	}
+	return false
+}
+
+// flow 返回主题在消费组下的流控状态，不存在时创建。
+func (m *WaterMillManager) flow(topic, group string) *flowControl {
+	m.flowMu.Lock()
+	defer m.flowMu.Unlock()
+	if m.flows == nil {
+		m.flows = map[string]*flowControl{}
+	}
+	key := topic + "\x00" + group
+	f, ok := m.flows[key]
+	if !ok {
+		f = &flowControl{}
+		m.flows[key] = f
+	}
+	return f
+}
+
+// flowOf 返回管理器中主题在消费组下的流控状态，管理器不支持流控时返回nil。
+func flowOf(m IManager, topic, group string) *flowControl {
+	if fm, ok := m.(interface {
+		flow(topic, group string) *flowControl
+	}); ok {
+		return fm.flow(topic, group)
+	}
+	return nil
+}
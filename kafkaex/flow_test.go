@@ -0,0 +1,127 @@
+package kafkaex
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	got := make(chan string, 10)
+	// 没有注册过的订阅无法暂停
+	assert.Equal(t, ErrNoFoundSubscription, m.Pause("orders", "g1"))
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithGroup("g1"), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		got <- string(box.Value)
+		return nil
+	})))
+	assert.Nil(t, m.Pause("orders", "g1"))
+	assert.Equal(t, ErrNoFoundSubscription, m.Resume("orders", "g2"))
+	box := NewBoxMessage()
+	box.Value = []byte("1")
+	assert.Nil(t, m.Publish("orders", box))
+	select {
+	case <-got:
+		t.Fatal("paused subscription should not consume")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.True(t, m.Subscriptions()[0].Paused)
+
+	assert.Nil(t, m.Resume("orders", "g1"))
+	select {
+	case v := <-got:
+		assert.Equal(t, "1", v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for resumed subscription")
+	}
+	assert.False(t, m.Subscriptions()[0].Paused)
+	assert.Equal(t, SubscriptionRunning, m.Subscriptions()[0].State)
+}
+
+func TestSetRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	got := make(chan time.Time, 10)
+	assert.Equal(t, ErrNoFoundSubscription, m.SetRateLimit("orders", "g1", 10))
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithGroup("g1"), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		got <- time.Now()
+		return nil
+	})))
+	assert.Nil(t, m.SetRateLimit("orders", "g1", 10))
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, m.Publish("orders", NewBoxMessage()))
+	}
+	begin := time.Now()
+	for i := 0; i < 4; i++ {
+		<-got
+	}
+	// 每秒10条，突发10条，前4条无需等待
+	assert.Less(t, time.Since(begin), time.Second)
+	assert.Equal(t, float64(10), m.Subscriptions()[0].RateLimit)
+
+	assert.Nil(t, m.SetRateLimit("orders", "g1", 0))
+	assert.Equal(t, float64(0), m.Subscriptions()[0].RateLimit)
+}
+
+func TestFlowWaitCancel(t *testing.T) {
+	f := &flowControl{}
+	assert.Nil(t, f.wait(context.Background()))
+	f.paused, f.resume = true, make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, f.wait(ctx), context.DeadlineExceeded)
+}
+
+func TestAdminSubscriptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithGroup("g1"), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		return nil
+	})))
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	assert.Nil(t, err)
+	audits := []*AuditEntry{}
+	h := NewAdminHandler(NewDeadLetters(store, m), WithAdminAudit(func(ctx context.Context, entry *AuditEntry) {
+		audits = append(audits, entry)
+	}))
+
+	rec, _ := doAdmin(h, http.MethodPost, "/subscriptions/pause?topic=orders&group=g1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, m.Subscriptions()[0].Paused)
+	rec, _ = doAdmin(h, http.MethodPost, "/subscriptions/ratelimit?topic=orders&group=g1&rps=5", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec, _ = doAdmin(h, http.MethodPost, "/subscriptions/resume?topic=orders&group=g1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec, resp := doAdmin(h, http.MethodGet, "/subscriptions", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	statuses := resp.Data.([]any)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, false, statuses[0].(map[string]any)["paused"])
+	assert.Equal(t, float64(5), statuses[0].(map[string]any)["rateLimit"])
+
+	rec, _ = doAdmin(h, http.MethodPost, "/subscriptions/pause?topic=orders", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 没有注册过的订阅返回404并记录审计
+	rec, _ = doAdmin(h, http.MethodPost, "/subscriptions/pause?topic=orders&group=g2", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec, _ = doAdmin(h, http.MethodPost, "/subscriptions/ratelimit?topic=orders&group=g1&rps=x", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	assert.Len(t, audits, 4)
+	assert.Equal(t, ErrNoFoundSubscription.Error(), audits[3].Err)
+	assert.Equal(t, int64(0), audits[3].Count)
+	assert.Equal(t, "ratelimit", audits[1].Action)
+	assert.Equal(t, "5", audits[1].Value)
+	assert.Equal(t, "orders", audits[1].Topic)
+	assert.Equal(t, "g1", audits[1].Group)
+	assert.Nil(t, audits[1].Filter)
+	assert.Equal(t, "oncall", audits[2].Operator)
+}
@@ -0,0 +1,125 @@
+package kafkaex
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// EventHandlers 定义了一个订阅上已注册的事件处理程序，用于生成文档。
+type EventHandlers struct {
+	Topic      string   `json:"topic"`      // 订阅的主题
+	Group      string   `json:"group"`      // 订阅的组别
+	EventTypes []string `json:"eventtypes"` // 已注册的事件类型，按名称排序
+	Fallback   bool     `json:"fallback"`   // 是否设置了兜底处理程序
+}
+
+// Typed 将按类型处理的函数转换为Handler，消息体由配置的编解码器解码为T，解码失败按处理失败进入重试。
+func Typed[T any](h func(ctx context.Context, box *BoxMessage, v *T) error) Handler {
+	return func(ctx context.Context, box *BoxMessage) error {
+		v := new(T)
+		if err := box.Decode(v); err != nil {
+			return err
+		}
+		return h(ctx, box, v)
+	}
+}
+
+// Handle 在主题与组别的同一个订阅上为事件类型注册处理程序，首次注册时记录opts，之后的opts仅组别生效。
+// 注册后需调用StartHandlers开始消费，未匹配任何事件类型的消息交给HandleFallback设置的兜底处理程序，未设置时确认后跳过并计入过滤指标。
+// 已开始消费的订阅不能再注册，返回ErrHandlersStarted。
+func (m *WaterMillManager) Handle(topic, eventType string, h Handler, opts ...Option) error {
+	router, err := m.handlers.route(topic, opts...)
+	if err != nil {
+		return err
+	}
+	router.Route(eventType, h)
+	return nil
+}
+
+// HandleFallback 设置主题与组别的订阅上未匹配事件类型时的兜底处理程序，需在StartHandlers之前设置。
+func (m *WaterMillManager) HandleFallback(topic string, h Handler, opts ...Option) error {
+	router, err := m.handlers.route(topic, opts...)
+	if err != nil {
+		return err
+	}
+	router.Fallback(h)
+	return nil
+}
+
+// StartHandlers 为通过Handle注册的每个主题与组别订阅一次并开始消费，已开始的订阅跳过，订阅失败时可再次调用。
+func (m *WaterMillManager) StartHandlers(ctx context.Context) error {
+	return m.handlers.start(ctx, m)
+}
+
+// EventHandlers 返回通过Handle注册的全部订阅及其事件类型，按主题与组别排序。
+func (m *WaterMillManager) EventHandlers() []*EventHandlers {
+	return m.handlers.list()
+}
+
+// eventEntry 一个主题与组别上收集的事件路由。
+type eventEntry struct {
+	router  *EventRouter
+	opts    []Option
+	started bool
+}
+
+// eventHandlers 按主题与组别收集事件处理程序，启动时每个主题与组别订阅一次，避免注册完成前消费的消息被当作未匹配确认。
+type eventHandlers struct {
+	mu      sync.Mutex
+	entries map[innerOrigin]*eventEntry
+}
+
+// route 返回主题与组别的事件路由，不存在时创建，已开始消费时返回ErrHandlersStarted。
+func (e *eventHandlers) route(topic string, opts ...Option) (*EventRouter, error) {
+	group := NewOptions(append([]Option{WithTopic(topic)}, opts...)...).Fmt().Group
+	key := innerOrigin{topic: topic, group: group}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if entry, ok := e.entries[key]; ok {
+		if entry.started {
+			return nil, ErrHandlersStarted
+		}
+		return entry.router, nil
+	}
+	if e.entries == nil {
+		e.entries = map[innerOrigin]*eventEntry{}
+	}
+	entry := &eventEntry{router: NewEventRouter(nil), opts: append(opts, WithGroup(group))}
+	e.entries[key] = entry
+	return entry.router, nil
+}
+
+// start 订阅尚未开始的主题与组别。
+func (e *eventHandlers) start(ctx context.Context, m IManager) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, entry := range e.entries {
+		if entry.started {
+			continue
+		}
+		if err := m.RegisterSubscriber(ctx, key.topic, append(entry.opts, WithHandle(entry.router.Handle))...); err != nil {
+			return err
+		}
+		entry.started = true
+	}
+	return nil
+}
+
+// list 返回全部主题与组别及其事件类型，按主题与组别排序。
+func (e *eventHandlers) list() []*EventHandlers {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	res := make([]*EventHandlers, 0, len(e.entries))
+	for key, entry := range e.entries {
+		types, fallback := entry.router.Types()
+		res = append(res, &EventHandlers{Topic: key.topic, Group: key.group, EventTypes: types, Fallback: fallback})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Topic != res[j].Topic {
+			return res[i].Topic < res[j].Topic
+		}
+		return res[i].Group < res[j].Group
+	})
+	return res
+}
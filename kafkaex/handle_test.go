@@ -0,0 +1,79 @@
+package kafkaex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type orderCreated struct {
+	Id     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+func TestHandleEventTypes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	got := make(chan string, 10)
+	assert.Nil(t, m.Handle("orders", "created", Typed(func(ctx context.Context, box *BoxMessage, v *orderCreated) error {
+		got <- v.Id
+		return nil
+	})))
+	assert.Nil(t, m.Handle("orders", "paid", func(ctx context.Context, box *BoxMessage) error {
+		got <- "paid"
+		return nil
+	}))
+	assert.Nil(t, m.HandleFallback("orders", func(ctx context.Context, box *BoxMessage) error {
+		got <- "unknown:" + box.EventType
+		return nil
+	}))
+	assert.Nil(t, m.Handle("orders", "created", func(ctx context.Context, box *BoxMessage) error {
+		return nil
+	}, WithGroup("audit")))
+
+	// StartHandlers之前发布的消息在全部处理程序注册后再消费
+	created, err := NewEvent("created", &orderCreated{Id: "o1", Amount: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":"o1","amount":10}`, string(created.Value))
+	assert.Nil(t, m.Publish("orders", created))
+	paid, _ := NewEvent("paid", nil)
+	assert.Nil(t, m.Publish("orders", paid))
+	refunded, _ := NewEvent("refunded", nil)
+	assert.Nil(t, m.Publish("orders", refunded))
+	assert.Len(t, m.Subscriptions(), 0)
+	assert.Nil(t, m.StartHandlers(ctx))
+	assert.Nil(t, m.StartHandlers(ctx))
+	assert.ElementsMatch(t, []string{"o1", "paid", "unknown:refunded"}, []string{<-got, <-got, <-got})
+
+	// 同一主题与组别共用一个订阅
+	assert.Len(t, m.Subscriptions(), 2)
+	assert.Equal(t, []*EventHandlers{
+		{Topic: "orders", Group: "audit", EventTypes: []string{"created"}},
+		{Topic: "orders", Group: "orders", EventTypes: []string{"created", "paid"}, Fallback: true},
+	}, m.EventHandlers())
+	assert.Equal(t, ErrHandlersStarted, m.Handle("orders", "shipped", func(ctx context.Context, box *BoxMessage) error { return nil }))
+}
+
+type rawCodec struct{ JSONCodec }
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	return []byte(v.(string)), nil
+}
+
+func TestSetCodec(t *testing.T) {
+	SetCodec(rawCodec{})
+	defer SetCodec(nil)
+	box, err := NewEvent("raw", "plain")
+	assert.Nil(t, err)
+	assert.Equal(t, "plain", string(box.Value))
+	assert.Equal(t, "raw", box.EventType)
+
+	SetCodec(nil)
+	var v orderCreated
+	box.Value = []byte(`{"id":"o2"}`)
+	assert.Nil(t, box.Decode(&v))
+	assert.Equal(t, "o2", v.Id)
+	assert.NotNil(t, Typed(func(ctx context.Context, box *BoxMessage, v *orderCreated) error { return nil })(context.Background(), NewBoxMessage()))
+}
@@ -0,0 +1,44 @@
+package kafkaex
+
+import (
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+)
+
+// IsReservedHeader 判断消息头是否使用了保留前缀，包括kafkaex内置前缀与watermill的消息ID头。
+func IsReservedHeader(key string) bool {
+	return strings.HasPrefix(key, APHMQH_PREFIX) || key == kafka.UUIDHeaderKey
+}
+
+// SetHeader 设置自定义消息头，使用保留前缀时返回ErrReservedHeader。
+func (m *BoxMessage) SetHeader(key, value string) error {
+	if IsReservedHeader(key) {
+		return ErrReservedHeader
+	}
+	if m.Headers == nil {
+		m.Headers = map[string]string{}
+	}
+	m.Headers[key] = value
+	return nil
+}
+
+// GetHeader 获取自定义消息头，不存在时返回空字符串。
+func (m *BoxMessage) GetHeader(key string) string {
+	return m.Headers[key]
+}
+
+// DelHeader 删除自定义消息头。
+func (m *BoxMessage) DelHeader(key string) {
+	delete(m.Headers, key)
+}
+
+// isPropagationHeader 判断消息头是否为链路传播使用的字段，如traceparent。
+func isPropagationHeader(key string) bool {
+	for _, f := range getPropagator().Fields() {
+		if f == key {
+			return true
+		}
+	}
+	return false
+}
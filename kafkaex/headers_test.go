@@ -0,0 +1,35 @@
+package kafkaex
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoxMessageHeaders(t *testing.T) {
+	box := NewBoxMessage().WithOption(WithTopic("topic1"))
+	assert.Nil(t, box.SetHeader("event-type", "order.created"))
+	assert.Equal(t, ErrReservedHeader, box.SetHeader(APHMQH_MSG_TOPIC, "clobber"))
+	assert.Equal(t, ErrReservedHeader, box.SetHeader(kafka.UUIDHeaderKey, "clobber"))
+	assert.Equal(t, "order.created", box.GetHeader("event-type"))
+
+	// 直接写入map的保留头不会覆盖内置字段
+	box.Headers[APHMQH_MSG_TOPIC] = "clobber"
+	msg := box.NewRawMessage()
+	assert.Equal(t, "topic1", msg.Metadata.Get(APHMQH_MSG_TOPIC))
+	assert.Equal(t, "order.created", msg.Metadata.Get("event-type"))
+
+	// 消费后自定义消息头完整还原，内置与链路字段不计入
+	msg.Metadata.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	got := NewBoxMessage().WithRawMessage(msg)
+	assert.Equal(t, map[string]string{"event-type": "order.created"}, got.Headers)
+	assert.Equal(t, "topic1", got.Topic)
+
+	// 重试、死信重新发布时保持不变
+	again := NewBoxMessage().WithRawMessage(got.NewRawMessage())
+	assert.Equal(t, got.Headers, again.Headers)
+
+	again.DelHeader("event-type")
+	assert.Equal(t, "", again.GetHeader("event-type"))
+}
@@ -0,0 +1,247 @@
+package kafkaex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 订阅状态
+const (
+	SubscriptionRunning = "running" // 消费中
+	SubscriptionStopped = "stopped" // 上下文结束或订阅关闭后正常退出
+	SubscriptionError   = "error"   // 阻塞策略下消费失败后退出
+)
+
+// SubscriptionStatus 定义了一个订阅的运行状态与积压情况。
+type SubscriptionStatus struct {
+	Topic     string     `json:"topic" form:"topic"`         // 主题
+	Group     string     `json:"group" form:"group"`         // 消费组
+	State     string     `json:"state" form:"state"`         // 状态，running、stopped或error
+	Err       string     `json:"err" form:"err"`             // 退出的原因
+	StartedAt int64      `json:"startedAt" form:"startedAt"` // 开始消费的时间戳
+	StoppedAt int64      `json:"stoppedAt" form:"stoppedAt"` // 退出的时间戳
+	Paused    bool       `json:"paused" form:"paused"`       // 是否已暂停
+	RateLimit float64    `json:"rateLimit" form:"rateLimit"` // 每秒处理的消息数量，0表示不限流
+	Breaker   string     `json:"breaker" form:"breaker"`     // 熔断器状态，未开启熔断时为空
+	Lag       int64      `json:"lag" form:"lag"`             // 各分区积压数量之和，仅Check时有效
+	LagErr    string     `json:"lagErr" form:"lagErr"`       // 查询积压失败的原因，仅Check时有效
+	Backlogs  []*Backlog `json:"backlogs" form:"backlogs"`   // 各分区的积压，仅Check时有效
+	breaker   *CircuitBreaker
+}
+
+// Subscriptions 返回全部订阅的状态快照。
+func (m *WaterMillManager) Subscriptions() []*SubscriptionStatus {
+	m.statusMu.RLock()
+	defer m.statusMu.RUnlock()
+	res := make([]*SubscriptionStatus, 0, len(m.statuses))
+	for _, s := range m.statuses {
+		v := *s
+		f := m.flow(s.Topic, s.Group)
+		f.mu.Lock()
+		v.Paused, v.RateLimit = f.paused, f.rps
+		f.mu.Unlock()
+		if s.breaker != nil {
+			v.Breaker = s.breaker.State()
+		}
+		res = append(res, &v)
+	}
+	return res
+}
+
+// track 记录一个开始消费的订阅。
+func (m *WaterMillManager) track(topic, group string, breaker *CircuitBreaker) *SubscriptionStatus {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	s := &SubscriptionStatus{Topic: topic, Group: group, State: SubscriptionRunning, StartedAt: time.Now().Unix(), breaker: breaker}
+	m.statuses = append(m.statuses, s)
+	return s
+}
+
+// untrack 记录订阅退出，err不为nil时为异常退出。
+func (m *WaterMillManager) untrack(s *SubscriptionStatus, err error) {
+	m.statusMu.Lock()
+	defer m.statusMu.Unlock()
+	s.State = SubscriptionStopped
+	s.StoppedAt = time.Now().Unix()
+	if err != nil {
+		s.State = SubscriptionError
+		s.Err = err.Error()
+	}
+}
+
+// HealthReport 定义了健康检查的结果。
+type HealthReport struct {
+	Healthy       bool                  `json:"healthy"`       // 是否健康
+	Reasons       []string              `json:"reasons"`       // 不健康的原因
+	Subscriptions []*SubscriptionStatus `json:"subscriptions"` // 各订阅的状态
+}
+
+// HealthOption 类型为函数，用于修改Health实例
+type HealthOption func(*Health)
+
+// WithHealthBacklog 设置积压的查询函数，默认使用Health持有的Kafka客户端查询。
+func WithHealthBacklog(f func(ctx context.Context, topic, group string) ([]*Backlog, error)) HealthOption {
+	return func(h *Health) {
+		h.backlog = f
+	}
+}
+
+// WithHealthMaxLag 设置就绪检查的积压阈值，任一分区积压超过maxLag时未就绪，为0时不检查积压。
+func WithHealthMaxLag(maxLag int64) HealthOption {
+	return func(h *Health) {
+		h.maxLag = maxLag
+	}
+}
+
+// Health 订阅的健康检查，提供Go接口与存活、就绪检查的http.Handler。
+// 存活检查: 存在异常退出(error)的订阅时失败，需要重启进程。
+// 就绪检查: 存在异常退出(error)的订阅时失败，上下文结束后正常退出(stopped)的订阅不影响就绪；仅在设置了WithHealthMaxLag时查询积压，未暂停订阅的任一分区积压超过阈值时失败。
+// 默认的积压查询在首次使用时创建Kafka客户端，之后的检查复用该客户端，不再使用时调用Close关闭。
+type Health struct {
+	subscriptions func() []*SubscriptionStatus
+	backlog       func(ctx context.Context, topic, group string) ([]*Backlog, error)
+	maxLag        int64
+	mu            sync.Mutex
+	client        sarama.Client
+}
+
+// NewHealth 创建并返回一个新的Health实例，m需提供Subscriptions方法（如WaterMillManager），否则视为没有订阅。
+func NewHealth(m IManager, opts ...HealthOption) *Health {
+	h := &Health{
+		subscriptions: func() []*SubscriptionStatus { return nil },
+	}
+	h.backlog = h.clientBacklog
+	if s, ok := m.(interface{ Subscriptions() []*SubscriptionStatus }); ok {
+		h.subscriptions = s.Subscriptions
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Close 关闭默认积压查询使用的Kafka客户端。
+func (h *Health) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.client == nil {
+		return nil
+	}
+	err := h.client.Close()
+	h.client = nil
+	return err
+}
+
+// clientBacklog 使用Health持有的Kafka客户端查询积压，客户端未创建或已关闭时重新创建。
+func (h *Health) clientBacklog(ctx context.Context, topic, group string) ([]*Backlog, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.client == nil || h.client.Closed() {
+		client, err := sarama.NewClient(getKafkaBrokers(), getConfig())
+		if err != nil {
+			return nil, err
+		}
+		h.client = client
+	}
+	return GetBacklog(h.client, topic, group)
+}
+
+// Check 返回各订阅的状态，并查询消费中订阅的分区积压。
+func (h *Health) Check(ctx context.Context) []*SubscriptionStatus {
+	statuses := h.subscriptions()
+	for _, s := range statuses {
+		if s.State != SubscriptionRunning {
+			continue
+		}
+		bs, err := h.backlog(ctx, s.Topic, s.Group)
+		if err != nil {
+			s.LagErr = err.Error()
+			continue
+		}
+		s.Backlogs = bs
+		for _, b := range bs {
+			s.Lag += b.Lag
+		}
+	}
+	return statuses
+}
+
+// Liveness 执行存活检查。
+func (h *Health) Liveness(ctx context.Context) *HealthReport {
+	report := &HealthReport{Healthy: true, Reasons: []string{}, Subscriptions: h.subscriptions()}
+	for _, s := range report.Subscriptions {
+		if s.State == SubscriptionError {
+			report.fail("%s/%s exited: %s", s.Topic, s.Group, s.Err)
+		}
+	}
+	return report
+}
+
+// Readiness 执行就绪检查，仅在设置了积压阈值时查询分区积压，默认只检查订阅状态。
+func (h *Health) Readiness(ctx context.Context) *HealthReport {
+	report := &HealthReport{Healthy: true, Reasons: []string{}}
+	if h.maxLag > 0 {
+		report.Subscriptions = h.Check(ctx)
+	} else {
+		report.Subscriptions = h.subscriptions()
+	}
+	for _, s := range report.Subscriptions {
+		if s.State == SubscriptionError {
+			report.fail("%s/%s is %s", s.Topic, s.Group, s.State)
+			continue
+		}
+		if s.State != SubscriptionRunning {
+			continue // 正常退出的订阅，如请求响应、Table或一次性消费的上下文结束
+		}
+		if h.maxLag <= 0 || s.Paused {
+			continue // 暂停的订阅不检查积压
+		}
+		if s.LagErr != "" {
+			report.fail("%s/%s lag unknown: %s", s.Topic, s.Group, s.LagErr)
+			continue
+		}
+		for _, b := range s.Backlogs {
+			if b.Lag > h.maxLag {
+				report.fail("%s/%s partition %d lag %d > %d", s.Topic, s.Group, b.Partition, b.Lag, h.maxLag)
+			}
+		}
+	}
+	return report
+}
+
+// LivenessHandler 返回存活检查的http.Handler，健康时状态码为200，否则为503。
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, h.Liveness(r.Context()))
+	})
+}
+
+// ReadinessHandler 返回就绪检查的http.Handler，就绪时状态码为200，否则为503。
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, h.Readiness(r.Context()))
+	})
+}
+
+// fail 标记为不健康并记录原因。
+func (r *HealthReport) fail(format string, args ...any) {
+	r.Healthy = false
+	r.Reasons = append(r.Reasons, fmt.Sprintf(format, args...))
+}
+
+// writeHealth 输出健康检查结果。
+func writeHealth(w http.ResponseWriter, report *HealthReport) {
+	status := http.StatusOK
+	if !report.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,107 @@
+package kafkaex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doHealth(h http.Handler) (int, *HealthReport) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	report := &HealthReport{}
+	_ = json.Unmarshal(rec.Body.Bytes(), report)
+	return rec.Code, report
+}
+
+func TestHealth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithGroup("g1"), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		return errors.New("fail")
+	})))
+	lag := int64(0)
+	h := NewHealth(m, WithHealthMaxLag(10), WithHealthBacklog(func(ctx context.Context, topic, group string) ([]*Backlog, error) {
+		return []*Backlog{{Topic: topic, Group: group, Partition: 0, Newest: 100, Committed: 100 - lag, Lag: lag}}, nil
+	}))
+
+	code, report := doHealth(h.ReadinessHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, SubscriptionRunning, report.Subscriptions[0].State)
+
+	// 积压超过阈值时未就绪，但仍存活
+	lag = 11
+	code, report = doHealth(h.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []string{"orders/g1 partition 0 lag 11 > 10"}, report.Reasons)
+	code, _ = doHealth(h.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+
+	// 阻塞策略下消费失败，订阅异常退出
+	box := NewBoxMessage().WithOption(WithExecType(1))
+	assert.Nil(t, m.Publish("orders", box))
+	assert.Eventually(t, func() bool {
+		return !h.Liveness(ctx).Healthy
+	}, 5*time.Second, 10*time.Millisecond)
+	code, report = doHealth(h.LivenessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, SubscriptionError, report.Subscriptions[0].State)
+	assert.Equal(t, "fail", report.Subscriptions[0].Err)
+}
+
+func TestHealthStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		return nil
+	})))
+	onceCtx, onceCancel := context.WithCancel(ctx)
+	assert.Nil(t, m.RegisterSubscriber(onceCtx, "users", WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		return nil
+	})))
+	h := NewHealth(m)
+	code, _ := doHealth(h.ReadinessHandler())
+	assert.Equal(t, http.StatusOK, code)
+
+	// 上下文结束后订阅正常退出，仍就绪且存活
+	onceCancel()
+	assert.Eventually(t, func() bool {
+		for _, s := range m.(*WaterMillManager).Subscriptions() {
+			if s.Topic == "users" {
+				return s.State == SubscriptionStopped
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	code, _ = doHealth(h.ReadinessHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, h.Liveness(context.Background()).Healthy)
+}
+
+func TestHealthReadinessWithoutLag(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		return nil
+	})))
+	queries := 0
+	h := NewHealth(m, WithHealthBacklog(func(ctx context.Context, topic, group string) ([]*Backlog, error) {
+		queries++
+		return nil, nil
+	}))
+	// 未设置积压阈值时就绪检查不查询积压
+	assert.True(t, h.Readiness(ctx).Healthy)
+	assert.Equal(t, 0, queries)
+	h.Check(ctx)
+	assert.Equal(t, 1, queries)
+	assert.Nil(t, h.Close())
+}
@@ -0,0 +1,54 @@
+package kafkaex
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+)
+
+// IsForeign 判断消息头中是否不含任何内置消息头，即消息由非kafkaex生产者产生（如Debezium、Java服务、kafka-console-producer）。
+func IsForeign(headers map[string]string) bool {
+	for k := range headers {
+		if strings.HasPrefix(k, APHMQH_PREFIX) {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRecord 从消费记录的上下文中读取分区、偏移量、键与时间戳，并返回修改后的实例。
+func (m *BoxMessage) WithRecord(ctx context.Context) *BoxMessage {
+	if v, ok := kafka.MessagePartitionFromCtx(ctx); ok {
+		m.Partition = v
+	}
+	if v, ok := kafka.MessagePartitionOffsetFromCtx(ctx); ok {
+		m.Offset = v
+	}
+	if v, ok := kafka.MessageTimestampFromCtx(ctx); ok && !v.IsZero() {
+		m.Timestamp = v.UnixMilli()
+	}
+	if v, ok := kafka.MessageKeyFromCtx(ctx); ok && m.Key == "" {
+		m.Key = string(v)
+	}
+	return m
+}
+
+// withInterop 使用消费到的记录与订阅配置补全外部消息的信封，使订阅的重试策略对外部消息同样生效。
+func (m *BoxMessage) withInterop(topic string, opt *Options) *BoxMessage {
+	m.Topic = topic
+	m.Group = opt.Group
+	m.RetryMax = opt.RetryMax
+	m.ExecType = opt.ExecType
+	if opt.HandleTimeout > 0 {
+		m.HandleTimeout = opt.HandleTimeout
+	}
+	if m.MsgId == "" {
+		m.MsgId = fmt.Sprintf("%s-%d-%d", topic, m.Partition, m.Offset)
+	}
+	if m.PublishAt == 0 {
+		m.PublishAt = m.Timestamp
+	}
+	return m
+}
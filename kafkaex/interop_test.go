@@ -0,0 +1,50 @@
+package kafkaex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsForeign(t *testing.T) {
+	assert.True(t, IsForeign(map[string]string{"content-type": "application/json"}))
+	assert.True(t, IsForeign(nil))
+	assert.False(t, IsForeign(NewBoxMessage().NewRawMessage().Metadata))
+}
+
+func TestInterop(t *testing.T) {
+	opt := NewOptions(WithGroup("group1"), WithRetryMax(3), WithHandleTimeout(time.Second), WithInterop()).Fmt()
+	assert.True(t, opt.Interop)
+
+	// 外部生产者的消息，没有任何内置消息头
+	msg := message.NewMessage("", []byte(`{"id":1}`))
+	msg.Metadata.Set("__TypeId__", "com.example.Order")
+
+	var got *BoxMessage
+	opt.Handle = func(ctx context.Context, box *BoxMessage) error {
+		got = box
+		return nil
+	}
+	process, err := processHanlder(GetManager(), "orders", "execer", opt)
+	assert.Nil(t, err)
+	ch := make(chan *message.Message, 1)
+	ch <- msg
+	close(ch)
+	process(context.Background(), ch)
+
+	assert.Equal(t, "orders", got.Topic)
+	assert.Equal(t, "group1", got.Group)
+	assert.Equal(t, int64(3), got.RetryMax)
+	assert.Equal(t, time.Second, got.HandleTimeout)
+	assert.Equal(t, "orders-0-0", got.MsgId)
+	assert.Equal(t, "com.example.Order", got.GetHeader("__TypeId__"))
+	assert.False(t, got.Dead())
+
+	// 非兼容模式下保持原样
+	box := NewBoxMessage().WithRawMessage(msg)
+	assert.Equal(t, "", box.Topic)
+	assert.Equal(t, int64(0), box.RetryMax)
+}
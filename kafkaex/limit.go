@@ -0,0 +1,107 @@
+package kafkaex
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterMaxKeys 按键限流时保留的最大键数量，超过时清理已空闲的令牌桶。
+const limiterMaxKeys = 10000
+
+// KeyedLimiter 订阅的令牌桶限流，可按消息键或租户等维度分别限流。
+// 消费协程按顺序处理消息，某个键等待令牌时后续消息同样等待。
+type KeyedLimiter struct {
+	rps      rate.Limit
+	burst    int
+	key      func(box *BoxMessage) string
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// NewKeyedLimiter 创建并返回一个新的KeyedLimiter实例，rps为每秒令牌数，burst为突发数量，key为nil时整个订阅共用一个令牌桶。
+func NewKeyedLimiter(rps float64, burst int, key func(box *BoxMessage) string) *KeyedLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &KeyedLimiter{
+		rps:      rate.Limit(rps),
+		burst:    burst,
+		key:      key,
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+// Wait 等待消息所属键的令牌，上下文结束时返回错误。
+func (l *KeyedLimiter) Wait(ctx context.Context, box *BoxMessage) error {
+	return l.limiter(box).Wait(ctx)
+}
+
+// limiter 返回消息所属键的令牌桶，不存在时创建。
+func (l *KeyedLimiter) limiter(box *BoxMessage) *rate.Limiter {
+	key := ""
+	if l.key != nil {
+		key = l.key(box)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lim, ok := l.limiters[key]; ok {
+		return lim
+	}
+	if len(l.limiters) >= limiterMaxKeys {
+		for k, lim := range l.limiters {
+			if lim.Tokens() >= float64(l.burst) {
+				delete(l.limiters, k) // 令牌已满的键近期没有消息，可安全清理
+			}
+		}
+	}
+	lim := rate.NewLimiter(l.rps, l.burst)
+	l.limiters[key] = lim
+	return lim
+}
+
+// LimitByKey 按消息键(Key)限流。
+func LimitByKey(box *BoxMessage) string {
+	return box.Key
+}
+
+// LimitByHeader 按自定义消息头限流，如租户ID。
+func LimitByHeader(name string) func(box *BoxMessage) string {
+	return func(box *BoxMessage) string {
+		return box.GetHeader(name)
+	}
+}
+
+// WithMaxConcurrency 设置管理器内全部订阅同时执行的处理程序数量上限，用于保护数据库连接池等共享资源，n小于等于0时不限制。
+func WithMaxConcurrency(n int) ManagerOption {
+	return func(m *WaterMillManager) {
+		m.sem = nil
+		if n > 0 {
+			m.sem = make(chan struct{}, n)
+		}
+	}
+}
+
+// acquire 获取一个执行名额，返回释放函数，上下文结束时返回错误。
+func (m *WaterMillManager) acquire(ctx context.Context) (func(), error) {
+	if m.sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case m.sem <- struct{}{}:
+		return func() { <-m.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// acquireOf 从管理器获取一个执行名额，管理器不支持并发上限时不限制。
+func acquireOf(ctx context.Context, m IManager) (func(), error) {
+	if am, ok := m.(interface {
+		acquire(ctx context.Context) (func(), error)
+	}); ok {
+		return am.acquire(ctx)
+	}
+	return func() {}, nil
+}
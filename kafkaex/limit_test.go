@@ -0,0 +1,80 @@
+package kafkaex
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	l := NewKeyedLimiter(1, 1, LimitByHeader("tenant"))
+	a := NewBoxMessage()
+	assert.Nil(t, a.SetHeader("tenant", "a"))
+	b := NewBoxMessage()
+	assert.Nil(t, b.SetHeader("tenant", "b"))
+
+	// 不同租户分别限流
+	assert.Nil(t, l.Wait(context.Background(), a))
+	assert.Nil(t, l.Wait(context.Background(), b))
+	// 同一租户超过突发数量时等待
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.NotNil(t, l.Wait(ctx, a))
+
+	box := NewBoxMessage().WithOption(WithKey("k1"))
+	assert.Equal(t, "k1", LimitByKey(box))
+}
+
+func TestRateLimitOption(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	got := make(chan struct{}, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithRateLimit(20, 1), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		got <- struct{}{}
+		return nil
+	})))
+	begin := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, m.Publish("orders", NewBoxMessage()))
+	}
+	for i := 0; i < 3; i++ {
+		<-got
+	}
+	// 每秒20条，突发1条，3条至少需要100毫秒
+	assert.GreaterOrEqual(t, time.Since(begin), 90*time.Millisecond)
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager(WithMaxConcurrency(1))
+	var running, peak atomic.Int32
+	got := make(chan struct{}, 10)
+	h := func(ctx context.Context, box *BoxMessage) error {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+		got <- struct{}{}
+		return nil
+	}
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithHandle(h)))
+	assert.Nil(t, m.RegisterSubscriber(ctx, "users", WithHandle(h)))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, m.Publish("orders", NewBoxMessage()))
+		assert.Nil(t, m.Publish("users", NewBoxMessage()))
+	}
+	for i := 0; i < 6; i++ {
+		<-got
+	}
+	assert.Equal(t, int32(1), peak.Load())
+}
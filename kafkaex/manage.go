@@ -2,18 +2,20 @@ package kafkaex
 
 import (
 	"context"
+	"sync"
 
 	"github.com/IBM/sarama"
 	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/illidaris/aphrodite/pkg/structure"
 )
 
 // GetManager 是用于获取默认消息管理器的函数。
-// 该函数确保仅初始化一次默认的消息管理器和日志记录器。
+// 该函数确保仅初始化一次默认的消息管理器和日志记录器，创建时使用SetManagerOptions设置的选项。
 // 返回值是初始化后的默认消息管理器实例，实现了IManager接口。
 func GetManager() IManager {
 	once.Do(func() {
-		defManager = NewWaterMillManager()
+		defManager = NewWaterMillManager(defManagerOpts...)
 	})
 	return defManager
 }
@@ -29,17 +31,111 @@ type IManager interface {
 }
 
 // NewWaterMillManager 是用于创建一个新的WaterMillManager实例的函数。
-// 返回值是一个初始化的WaterMillManager实例，包含了空的订阅者和发布者映射。
-func NewWaterMillManager() IManager {
+// 返回值是一个初始化的WaterMillManager实例，包含了空的订阅者和发布者映射，默认使用Kafka发布者与订阅者。
+func NewWaterMillManager(opts ...ManagerOption) IManager {
 	m := &WaterMillManager{
 		Subs: structure.NewItemMap[kafka.Subscriber](),
 		Pubs: structure.NewItemMap[kafka.Publisher](),
+		subs: structure.NewItemMap[message.Subscriber](),
+		pubs: structure.NewItemMap[message.Publisher](),
+		newPublisher: func(topic string, ow func(*sarama.Config) *sarama.Config) (message.Publisher, error) {
+			return NewPublisher(topic, ow)
+		},
+		newSubscriber: func(group string, ow func(*sarama.Config) *sarama.Config) (message.Subscriber, error) {
+			return NewSubscriber(group, ow)
+		},
+		watermarks: TopicWatermarks,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.provision != nil {
+		m.provision()
 	}
 	return m
 }
 
 // WaterMillManager 是具体的消息管理器实现，负责管理订阅者和发布者。
 type WaterMillManager struct {
-	Subs structure.ItemMap[kafka.Subscriber] // 存储订阅者
-	Pubs structure.ItemMap[kafka.Publisher]  // 存储发布者
+	Subs          structure.ItemMap[kafka.Subscriber]                                                    // 存储Kafka订阅者，使用自定义订阅者时不记录
+	Pubs          structure.ItemMap[kafka.Publisher]                                                     // 存储Kafka发布者，使用自定义发布者时不记录
+	subs          structure.ItemMap[message.Subscriber]                                                  // 存储订阅者
+	pubs          structure.ItemMap[message.Publisher]                                                   // 存储发布者
+	newPublisher  func(topic string, ow func(*sarama.Config) *sarama.Config) (message.Publisher, error)  // 创建发布者
+	newSubscriber func(group string, ow func(*sarama.Config) *sarama.Config) (message.Subscriber, error) // 创建订阅者
+	innerMu       sync.Mutex                                                                             // 保护重试与死信的自动注册
+	retryHandle   Handler                                                                                // 重试处理程序，用于自动注册按模板命名的重试消费
+	deadHandle    Handler                                                                                // 死信处理程序，用于自动注册按模板命名的死信消费
+	innerOrigins  []innerOrigin                                                                          // 已注册的源订阅
+	innerTopics   map[string]bool                                                                        // 已订阅的按模板命名的重试与死信主题
+	provision     func()                                                                                 // 启动时同步主题
+	statusMu      sync.RWMutex                                                                           // 保护订阅状态
+	statuses      []*SubscriptionStatus                                                                  // 订阅状态
+	flowMu        sync.Mutex                                                                             // 保护订阅的流控状态
+	flows         map[string]*flowControl                                                                // 订阅的暂停与限流状态
+	sem           chan struct{}                                                                          // 全部订阅同时执行的处理程序数量上限
+	scheduler     *Scheduler                                                                             // 延迟消息调度器
+	replyTopic    string                                                                                 // 接收响应的主题，每个实例独立
+	replyMu       sync.Mutex                                                                             // 保护响应主题的订阅状态
+	replying      bool                                                                                   // 是否已订阅响应主题
+	pendingMu     sync.Mutex                                                                             // 保护等待响应的请求
+	pending       map[string]chan *BoxMessage                                                            // 等待响应的请求，按关联ID索引
+	handlers      eventHandlers                                                                          // 通过Handle注册的事件处理程序，按主题与组别收集
+	watermarks    func(ctx context.Context, topic string) (map[int32]int64, error)                       // 获取主题各分区的最新偏移量
+}
+
+// ManagerOption 类型为函数，用于修改WaterMillManager实例
+type ManagerOption func(*WaterMillManager)
+
+// WithPublisherFactory 设置创建发布者的函数，用于替换默认的Kafka发布者。
+func WithPublisherFactory(f func(topic string, ow func(*sarama.Config) *sarama.Config) (message.Publisher, error)) ManagerOption {
+	return func(m *WaterMillManager) {
+		m.newPublisher = f
+	}
+}
+
+// WithSubscriberFactory 设置创建订阅者的函数，用于替换默认的Kafka订阅者。
+func WithSubscriberFactory(f func(group string, ow func(*sarama.Config) *sarama.Config) (message.Subscriber, error)) ManagerOption {
+	return func(m *WaterMillManager) {
+		m.newSubscriber = f
+	}
+}
+
+// WithWatermarks 设置获取主题各分区最新偏移量的函数，用于Table判断是否已追上，默认使用TopicWatermarks。
+func WithWatermarks(f func(ctx context.Context, topic string) (map[int32]int64, error)) ManagerOption {
+	return func(m *WaterMillManager) {
+		m.watermarks = f
+	}
+}
+
+// WithTopicProvision 在创建管理器时按声明同步主题：创建缺失的主题并输出差异日志，同步失败不影响管理器的创建。
+// newAdmin为nil时使用NewClusterAdmin，opts可配置WithProvisionApply修正差异。
+func WithTopicProvision(newAdmin func() (sarama.ClusterAdmin, error), specs []*TopicSpec, opts ...ProvisionOption) ManagerOption {
+	return func(m *WaterMillManager) {
+		if newAdmin == nil {
+			newAdmin = NewClusterAdmin
+		}
+		m.provision = func() {
+			ctx := context.Background()
+			admin, err := newAdmin()
+			if err != nil {
+				deflog.ErrorCtx(ctx, "同步主题失败%v", err)
+				return
+			}
+			defer admin.Close()
+			report, err := ProvisionTopics(admin, specs, opts...)
+			for _, name := range report.Created {
+				deflog.InfoCtx(ctx, "创建主题%s", name)
+			}
+			for _, d := range report.Drifts {
+				deflog.ErrorCtx(ctx, "主题%s配置%s不一致，声明%s，集群%s", d.Topic, d.Field, d.Want, d.Got)
+			}
+			for _, d := range report.Applied {
+				deflog.InfoCtx(ctx, "主题%s配置%s已修正为%s", d.Topic, d.Field, d.Want)
+			}
+			if err != nil {
+				deflog.ErrorCtx(ctx, "同步主题失败%v", err)
+			}
+		}
+	}
 }
@@ -0,0 +1,64 @@
+package kafkaex
+
+import (
+	"context"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+)
+
+// NewMemoryManager 创建一个基于内存(gochannel)的消息管理器，不依赖Kafka，用于测试与本地开发。
+// 所有组别共享同一个内存队列，消息会被持久化在内存中，后订阅者同样可以收到之前发布的消息。
+// opts可配置除发布者与订阅者以外的管理器选项，如WithMaxConcurrency。
+func NewMemoryManager(opts ...ManagerOption) IManager {
+	pubsub := &memoryPubSub{
+		GoChannel: gochannel.NewGoChannel(gochannel.Config{
+			OutputChannelBuffer: 1024,
+			Persistent:          true,
+		}, NewWaterMillLogger()),
+		counts: map[string]int64{},
+	}
+	return NewWaterMillManager(append([]ManagerOption{
+		WithPublisherFactory(func(topic string, ow func(*sarama.Config) *sarama.Config) (message.Publisher, error) {
+			return pubsub, nil
+		}),
+		WithSubscriberFactory(func(group string, ow func(*sarama.Config) *sarama.Config) (message.Subscriber, error) {
+			return memorySubscriber{pubsub}, nil
+		}),
+		WithWatermarks(pubsub.watermarks),
+	}, opts...)...)
+}
+
+// memoryPubSub 记录各主题发布数量的内存队列，内存队列没有分区，视为单个分区0。
+type memoryPubSub struct {
+	*gochannel.GoChannel
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// memorySubscriber 共享内存队列的订阅者，关闭订阅者时不关闭共享的内存队列。
+type memorySubscriber struct {
+	*memoryPubSub
+}
+
+// Close 实现message.Subscriber接口，共享的内存队列随上下文结束停止投递，无需关闭。
+func (s memorySubscriber) Close() error {
+	return nil
+}
+
+// Publish 发布消息并记录主题的消息数量。
+func (p *memoryPubSub) Publish(topic string, messages ...*message.Message) error {
+	p.mu.Lock()
+	p.counts[topic] += int64(len(messages))
+	p.mu.Unlock()
+	return p.GoChannel.Publish(topic, messages...)
+}
+
+// watermarks 返回主题已发布的消息数量作为分区0的最新偏移量。
+func (p *memoryPubSub) watermarks(ctx context.Context, topic string) (map[int32]int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return map[int32]int64{0: p.counts[topic]}, nil
+}
@@ -0,0 +1,44 @@
+package kafkaex
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryManager(t *testing.T) {
+	SetRetryDelay(time.Millisecond)
+	defer SetRetryDelay(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := NewMemoryManager()
+	attempts := make(chan int64, 10)
+	dead := make(chan *BoxMessage, 1)
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		attempts <- box.RetryIndex
+		return errors.New("fail")
+	})))
+	assert.Nil(t, m.RegisterRetry(ctx, nil))
+	assert.Nil(t, m.RegisterDead(ctx, func(ctx context.Context, box *BoxMessage) error {
+		dead <- box
+		return nil
+	}))
+
+	box := NewBoxMessage().WithOption(WithRetryMax(2))
+	box.Value = []byte("hello")
+	assert.Nil(t, m.Publish("orders", box))
+
+	select {
+	case got := <-dead:
+		assert.Equal(t, "orders", got.Topic)
+		assert.Equal(t, "fail", got.ExecErr)
+		assert.Equal(t, []byte("hello"), got.Value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for dead letter")
+	}
+	assert.Equal(t, []int64{0, 1, 2}, []int64{<-attempts, <-attempts, <-attempts})
+}
@@ -24,11 +24,22 @@ func NewBoxMessage() *BoxMessage {
 // BoxMessage 定义了一个消息结构体，包括基础的消息信息和执行相关的信息。
 type BoxMessage struct {
 	Options
-	MsgId   string `json:"msgid" form:"msgid"`     // 消息ID
-	Execer  string `json:"execer" form:"execer"`   // 执行者
-	ExecAt  int64  `json:"execat" form:"execat"`   // 执行时间戳
-	ExecErr string `json:"execerr" form:"execerr"` // 执行错误信息
-	Value   []byte `json:"val" form:"val"`         // 消息值
+	MsgId       string            `json:"msgid" form:"msgid"`             // 消息ID
+	Execer      string            `json:"execer" form:"execer"`           // 执行者
+	ExecAt      int64             `json:"execat" form:"execat"`           // 执行时间戳
+	ExecErr     string            `json:"execerr" form:"execerr"`         // 执行错误信息
+	ExecGroup   string            `json:"execgp" form:"execgp"`           // 执行失败的组别，用于命名重试与死信主题
+	PublishAt   int64             `json:"pubat" form:"pubat"`             // 发布时间戳(毫秒)
+	Correlation string            `json:"corrid" form:"corrid"`           // 关联请求与响应的ID，仅请求与响应有效
+	ReplyTo     string            `json:"replyto" form:"replyto"`         // 接收响应的主题，仅请求有效
+	SagaId      string            `json:"sagaid" form:"sagaid"`           // 所属的Saga实例ID
+	Partition   int32             `json:"partition" form:"partition"`     // 消费记录所在分区，仅消费时有效
+	Offset      int64             `json:"offset" form:"offset"`           // 消费记录的偏移量，仅消费时有效
+	Timestamp   int64             `json:"timestamp" form:"timestamp"`     // 消费记录的时间戳(毫秒)，仅消费时有效
+	Propagation map[string]string `json:"propagation" form:"propagation"` // 链路传播信息，如traceparent
+	Metas       map[string]string `json:"metas" form:"metas"`             // 透传的上下文键值，如sessionId
+	Headers     map[string]string `json:"headers" form:"headers"`         // 用户自定义消息头，不可使用保留前缀
+	Value       []byte            `json:"val" form:"val"`                 // 消息值
 }
 
 // Dead 判断消息是否进入死信状态。当RetryMax为0或RetryIndex大于等于RetryMax时，返回true。
@@ -36,6 +47,11 @@ func (m *BoxMessage) Dead() bool {
 	return m.RetryMax == 0 || m.RetryIndex >= m.RetryMax
 }
 
+// Expired 判断消息是否已过期。未设置过期时间时返回false。
+func (m *BoxMessage) Expired() bool {
+	return m.ExpireAt > 0 && time.Now().UnixMilli() >= m.ExpireAt
+}
+
 // Blocked 消费进入阻塞状态。
 func (m *BoxMessage) Blocked() bool {
 	return m.ExecType == 1
@@ -62,16 +78,21 @@ func (m *BoxMessage) WithOption(opts ...Option) *BoxMessage {
 	return m
 }
 
-// WithRawMessage 根据message.Message更新BoxMessage实例，并返回修改后的实例。它会设置MsgId和Value，并应用消息的元数据作为选项。
+// WithRawMessage 根据message.Message更新BoxMessage实例，并返回修改后的实例。它会设置MsgId和Value，应用消息的元数据作为选项，并读取消费记录信息。
 func (m *BoxMessage) WithRawMessage(msg *message.Message) *BoxMessage {
 	m.MsgId = msg.UUID
 	m.Value = msg.Payload
-	return m.WithHeadersOption(msg.Metadata)
+	return m.WithHeadersOption(msg.Metadata).WithRecord(msg.Context())
 }
 
-// NewRawMessage 根据BoxMessage的内容创建一个新的message.Message实例，并返回该实例。它会使用BoxMessage中的字段设置消息的元数据。
+// NewRawMessage 根据BoxMessage的内容创建一个新的message.Message实例，并返回该实例。它会使用BoxMessage中的字段与自定义消息头设置消息的元数据。
 func (m *BoxMessage) NewRawMessage() *message.Message {
 	msg := message.NewMessage(watermill.NewUUID(), m.Value)
+	for k, v := range m.Headers {
+		if !IsReservedHeader(k) {
+			msg.Metadata.Set(k, v)
+		}
+	}
 	msg.Metadata.Set(APHMQH_MSG_GROUP, m.Group)
 	msg.Metadata.Set(APHMQH_MSG_TOPIC, m.Topic)
 	msg.Metadata.Set(APHMQH_PARTITION_KEY, m.Key)
@@ -84,10 +105,22 @@ func (m *BoxMessage) NewRawMessage() *message.Message {
 	msg.Metadata.Set(APHMQH_EXECER, m.Execer)
 	msg.Metadata.Set(APHMQH_EXECAT, cast.ToString(m.ExecAt))
 	msg.Metadata.Set(APHMQH_EXECERR, m.ExecErr)
+	msg.Metadata.Set(APHMQH_EXEC_GROUP, m.ExecGroup)
+	msg.Metadata.Set(APHMQH_PUBLISH_AT, cast.ToString(m.PublishAt))
+	msg.Metadata.Set(APHMQH_DELIVER_AT, cast.ToString(m.DeliverAt))
+	msg.Metadata.Set(APHMQH_EXPIRE_AT, cast.ToString(m.ExpireAt))
+	msg.Metadata.Set(APHMQH_CORRELATION, m.Correlation)
+	msg.Metadata.Set(APHMQH_REPLY_TO, m.ReplyTo)
+	msg.Metadata.Set(APHMQH_EVENT_TYPE, m.EventType)
+	msg.Metadata.Set(APHMQH_SAGA_ID, m.SagaId)
+	for k, v := range m.Propagation {
+		msg.Metadata.Set(k, v)
+	}
+	metasToHeaders(m.Metas, msg.Metadata)
 	return msg
 }
 
-// WithHeadersOption 使用headers中的信息更新BoxMessage实例，并返回修改后的实例。它从headers中读取配置项并应用到BoxMessage上。
+// WithHeadersOption 使用headers中的信息更新BoxMessage实例，并返回修改后的实例。它从headers中读取配置项并应用到BoxMessage上，非内置的消息头保存为自定义消息头。
 func (m *BoxMessage) WithHeadersOption(headers map[string]string) *BoxMessage {
 	if v := headers[APHMQH_MSG_GROUP]; v != "" {
 		m.Group = v
@@ -123,5 +156,52 @@ func (m *BoxMessage) WithHeadersOption(headers map[string]string) *BoxMessage {
 	if v := headers[APHMQH_EXECERR]; v != "" {
 		m.ExecErr = v
 	}
+	if v := headers[APHMQH_EXEC_GROUP]; v != "" {
+		m.ExecGroup = v
+	}
+	if v := headers[APHMQH_PUBLISH_AT]; v != "" {
+		m.PublishAt = cast.ToInt64(v)
+	}
+	if v := headers[APHMQH_DELIVER_AT]; v != "" {
+		m.DeliverAt = cast.ToInt64(v)
+	}
+	if v := headers[APHMQH_EXPIRE_AT]; v != "" {
+		m.ExpireAt = cast.ToInt64(v)
+	}
+	if v := headers[APHMQH_CORRELATION]; v != "" {
+		m.Correlation = v
+	}
+	if v := headers[APHMQH_REPLY_TO]; v != "" {
+		m.ReplyTo = v
+	}
+	if v := headers[APHMQH_EVENT_TYPE]; v != "" {
+		m.EventType = v
+	}
+	if v := headers[APHMQH_SAGA_ID]; v != "" {
+		m.SagaId = v
+	}
+	for _, f := range getPropagator().Fields() {
+		if v := headers[f]; v != "" {
+			if m.Propagation == nil {
+				m.Propagation = map[string]string{}
+			}
+			m.Propagation[f] = v
+		}
+	}
+	for k, v := range metasFromHeaders(headers) {
+		if m.Metas == nil {
+			m.Metas = map[string]string{}
+		}
+		m.Metas[k] = v
+	}
+	for k, v := range headers {
+		if IsReservedHeader(k) || isPropagationHeader(k) {
+			continue
+		}
+		if m.Headers == nil {
+			m.Headers = map[string]string{}
+		}
+		m.Headers[k] = v
+	}
 	return m
 }
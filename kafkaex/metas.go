@@ -0,0 +1,119 @@
+package kafkaex
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/illidaris/core"
+	"github.com/spf13/cast"
+)
+
+// 定义上下文透传相关的全局变量，用于控制哪些ctx键值随消息头传递以及长度限制。
+var (
+	metaKeys        = []core.MetaData{core.SessionID} // 允许透传的上下文键，默认仅会话ID
+	metaMaxValueLen = 256                             // 单个值的最大长度
+	metaMaxTotalLen = 4096                            // 所有值的总长度上限
+)
+
+// SetMetaKeys 设置允许随消息头透传的上下文键（白名单），传入空则关闭透传。
+func SetMetaKeys(keys ...core.MetaData) {
+	metaKeys = keys
+}
+
+// SetMetaLimit 设置透传值的长度限制，maxValueLen为单个值上限，maxTotalLen为总长度上限，小于等于0表示不限制。
+func SetMetaLimit(maxValueLen, maxTotalLen int) {
+	metaMaxValueLen = maxValueLen
+	metaMaxTotalLen = maxTotalLen
+}
+
+// metaAllowed 判断上下文键是否在白名单中。
+func metaAllowed(key string) bool {
+	for _, k := range metaKeys {
+		if k.String() == key {
+			return true
+		}
+	}
+	return false
+}
+
+// captureMetas 从ctx中提取白名单内的键值，超出长度限制的值将被忽略。
+func captureMetas(ctx context.Context, metas map[string]string) map[string]string {
+	total := 0
+	for _, v := range metas {
+		total += len(v)
+	}
+	for _, k := range metaKeys {
+		raw := k.Get(ctx)
+		if raw == nil {
+			continue
+		}
+		v, err := cast.ToStringE(raw)
+		if err != nil || v == "" {
+			continue
+		}
+		if !metaFits(v, total-len(metas[k.String()])) {
+			deflog.InfoCtx(ctx, "上下文%s超出长度限制，已忽略", k.String())
+			continue
+		}
+		if metas == nil {
+			metas = map[string]string{}
+		}
+		total += len(v) - len(metas[k.String()])
+		metas[k.String()] = v
+	}
+	return metas
+}
+
+// restoreMetas 将白名单内的键值按键的顺序写回ctx，超出长度限制的值将被忽略，保证每次恢复的结果一致。
+func restoreMetas(ctx context.Context, metas map[string]string) context.Context {
+	keys := make([]string, 0, len(metas))
+	for k := range metas {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	total := 0
+	for _, k := range keys {
+		v := metas[k]
+		if !metaAllowed(k) || !metaFits(v, total) {
+			continue
+		}
+		total += len(v)
+		ctx = core.MetaData(k).SetString(ctx, v)
+	}
+	return ctx
+}
+
+// metaFits 判断值在已用长度total的基础上是否满足长度限制。
+func metaFits(v string, total int) bool {
+	if metaMaxValueLen > 0 && len(v) > metaMaxValueLen {
+		return false
+	}
+	if metaMaxTotalLen > 0 && total+len(v) > metaMaxTotalLen {
+		return false
+	}
+	return true
+}
+
+// metasToHeaders 将透传键值写入消息头，键名附加APHMQH_META_PREFIX前缀。
+func metasToHeaders(metas map[string]string, headers map[string]string) {
+	for k, v := range metas {
+		headers[APHMQH_META_PREFIX+k] = v
+	}
+}
+
+// metasFromHeaders 从消息头中读取透传键值，仅保留白名单内的键。
+func metasFromHeaders(headers map[string]string) map[string]string {
+	var metas map[string]string
+	for k, v := range headers {
+		key, ok := strings.CutPrefix(k, APHMQH_META_PREFIX)
+		if !ok || !metaAllowed(key) {
+			continue
+		}
+		if metas == nil {
+			metas = map[string]string{}
+		}
+		metas[key] = v
+	}
+	return metas
+}
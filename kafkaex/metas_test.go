@@ -0,0 +1,71 @@
+package kafkaex
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/illidaris/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetasRoundTrip(t *testing.T) {
+	const tenant core.MetaData = "tenant"
+	SetMetaKeys(core.SessionID, tenant)
+	defer SetMetaKeys(core.SessionID)
+
+	ctx := context.Background()
+	ctx = core.SessionID.SetString(ctx, "session1")
+	ctx = tenant.Set(ctx, 1001)
+	ctx = core.Action.SetString(ctx, "not allowed")
+
+	box := NewBoxMessage().WithContext(ctx)
+	assert.Equal(t, map[string]string{"sessionId": "session1", "tenant": "1001"}, box.Metas)
+
+	msg := box.NewRawMessage()
+	assert.Equal(t, "session1", msg.Metadata.Get(APHMQH_META_PREFIX+"sessionId"))
+	msg.Metadata.Set(APHMQH_META_PREFIX+core.Action.String(), "injected")
+
+	got := NewBoxMessage().WithRawMessage(msg)
+	assert.Equal(t, box.Metas, got.Metas)
+
+	var handleCtx context.Context
+	err := invoke(context.Background(), got, func(ctx context.Context, box *BoxMessage) error {
+		handleCtx = ctx
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "session1", core.SessionID.GetString(handleCtx))
+	assert.Equal(t, "1001", tenant.GetString(handleCtx))
+	assert.Equal(t, "", core.Action.GetString(handleCtx))
+}
+
+func TestMetasLimit(t *testing.T) {
+	const user core.MetaData = "userId"
+	SetMetaKeys(core.SessionID, user)
+	SetMetaLimit(8, 12)
+	defer func() {
+		SetMetaKeys(core.SessionID)
+		SetMetaLimit(256, 4096)
+	}()
+
+	ctx := context.Background()
+	ctx = core.SessionID.SetString(ctx, strings.Repeat("s", 9))
+	ctx = user.SetString(ctx, strings.Repeat("u", 8))
+	// 单个值超出长度被忽略
+	assert.Equal(t, map[string]string{"userId": "uuuuuuuu"}, captureMetas(ctx, nil))
+
+	ctx = core.SessionID.SetString(ctx, strings.Repeat("s", 8))
+	// 总长度超出时后续值被忽略
+	assert.Len(t, captureMetas(ctx, nil), 1)
+
+	restored := restoreMetas(context.Background(), map[string]string{"sessionId": strings.Repeat("s", 9)})
+	assert.Equal(t, "", core.SessionID.GetString(restored))
+
+	// 总长度超出时按键的顺序保留，结果稳定
+	for i := 0; i < 20; i++ {
+		restored = restoreMetas(context.Background(), map[string]string{"sessionId": "ssssss", "userId": "uuuuuuuu"})
+		assert.Equal(t, "ssssss", core.SessionID.GetString(restored))
+		assert.Equal(t, "", user.GetString(restored))
+	}
+}
@@ -0,0 +1,207 @@
+package kafkaex
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defMetrics 默认的指标采集器，未启用时为nil，所有采集方法均可安全调用。
+var defMetrics *Metrics
+
+// Metrics 定义了kafkaex的Prometheus指标采集器集合。
+type Metrics struct {
+	PublishTotal    *prometheus.CounterVec   // 发布消息总数，按主题区分
+	PublishErrors   *prometheus.CounterVec   // 发布失败总数，按主题区分
+	PublishDuration *prometheus.HistogramVec // 发布耗时，按主题区分
+	ConsumeTotal    *prometheus.CounterVec   // 消费消息总数，按主题、组别区分
+	ConsumeErrors   *prometheus.CounterVec   // 消费失败总数，按主题、组别区分
+	HandleDuration  *prometheus.HistogramVec // 处理函数耗时，按主题、组别区分
+	RetryTotal      *prometheus.CounterVec   // 进入重试队列总数，按源主题区分
+	DeadTotal       *prometheus.CounterVec   // 进入死信队列总数，按源主题区分
+	InFlight        *prometheus.GaugeVec     // 正在执行的处理函数数量，按主题、组别区分
+	EndToEnd        *prometheus.HistogramVec // 从发布到开始处理的端到端延迟，按主题、组别区分
+	ExpiredTotal    *prometheus.CounterVec   // 过期未处理的消息总数，按主题、组别区分
+	FilteredTotal   *prometheus.CounterVec   // 被过滤或未匹配路由的消息总数，按主题、组别区分
+}
+
+// NewMetrics 创建并返回一个新的Metrics实例，namespace为指标名前缀，为空时使用kafkaex。
+func NewMetrics(namespace string) *Metrics {
+	if namespace == "" {
+		namespace = "kafkaex"
+	}
+	return &Metrics{
+		PublishTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "publish_total",
+			Help:      "Total number of published messages.",
+		}, []string{"topic"}),
+		PublishErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "publish_errors_total",
+			Help:      "Total number of failed publishes.",
+		}, []string{"topic"}),
+		PublishDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "publish_duration_seconds",
+			Help:      "Publish latency in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"topic"}),
+		ConsumeTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "consume_total",
+			Help:      "Total number of consumed messages.",
+		}, []string{"topic", "group"}),
+		ConsumeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "consume_errors_total",
+			Help:      "Total number of handler errors.",
+		}, []string{"topic", "group"}),
+		HandleDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "handle_duration_seconds",
+			Help:      "Handler execution time in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"topic", "group"}),
+		RetryTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retry_total",
+			Help:      "Total number of messages sent to the retry topic.",
+		}, []string{"topic"}),
+		DeadTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dead_total",
+			Help:      "Total number of messages sent to the dead letter topic.",
+		}, []string{"topic"}),
+		InFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "handle_in_flight",
+			Help:      "Number of handlers currently executing.",
+		}, []string{"topic", "group"}),
+		EndToEnd: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "end_to_end_latency_seconds",
+			Help:      "Latency from publish to the start of handling in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"topic", "group"}),
+		ExpiredTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "expired_total",
+			Help:      "Total number of expired messages skipped before handling.",
+		}, []string{"topic", "group"}),
+		FilteredTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "filtered_total",
+			Help:      "Total number of messages skipped by filters or unmatched routes.",
+		}, []string{"topic", "group"}),
+	}
+}
+
+// Collectors 返回全部指标采集器。
+func (m *Metrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.PublishTotal, m.PublishErrors, m.PublishDuration,
+		m.ConsumeTotal, m.ConsumeErrors, m.HandleDuration,
+		m.RetryTotal, m.DeadTotal, m.InFlight, m.EndToEnd,
+		m.ExpiredTotal, m.FilteredTotal,
+	}
+}
+
+// Register 将全部指标采集器注册到指定的注册器。
+func (m *Metrics) Register(reg prometheus.Registerer) error {
+	for _, c := range m.Collectors() {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnableMetrics 创建指标采集器并注册到调用方提供的注册器，同时设置为默认采集器。
+func EnableMetrics(reg prometheus.Registerer, namespace string) (*Metrics, error) {
+	m := NewMetrics(namespace)
+	if err := m.Register(reg); err != nil {
+		return nil, err
+	}
+	defMetrics = m
+	return m, nil
+}
+
+// SetMetrics 设置默认的指标采集器，传入nil则关闭采集。
+func SetMetrics(m *Metrics) {
+	defMetrics = m
+}
+
+// getMetrics 返回默认的指标采集器。
+func getMetrics() *Metrics {
+	return defMetrics
+}
+
+// ObservePublish 记录一次发布的结果与耗时。
+func (m *Metrics) ObservePublish(topic string, begin time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.PublishTotal.WithLabelValues(topic).Inc()
+	m.PublishDuration.WithLabelValues(topic).Observe(time.Since(begin).Seconds())
+	if err != nil {
+		m.PublishErrors.WithLabelValues(topic).Inc()
+	}
+}
+
+// HandleStart 记录一次处理开始，并根据发布时间戳(毫秒)记录端到端延迟，返回处理结束时需调用的函数。
+func (m *Metrics) HandleStart(topic, group string, publishAt int64) func(err error) {
+	if m == nil {
+		return func(error) {}
+	}
+	begin := time.Now()
+	if publishAt > 0 {
+		latency := begin.Sub(time.UnixMilli(publishAt))
+		if latency < 0 {
+			latency = 0
+		}
+		m.EndToEnd.WithLabelValues(topic, group).Observe(latency.Seconds())
+	}
+	inFlight := m.InFlight.WithLabelValues(topic, group)
+	inFlight.Inc()
+	return func(err error) {
+		inFlight.Dec()
+		m.ConsumeTotal.WithLabelValues(topic, group).Inc()
+		m.HandleDuration.WithLabelValues(topic, group).Observe(time.Since(begin).Seconds())
+		if err != nil {
+			m.ConsumeErrors.WithLabelValues(topic, group).Inc()
+		}
+	}
+}
+
+// ObserveRetry 记录一次进入重试队列，topic为消息的源主题。
+func (m *Metrics) ObserveRetry(topic string) {
+	if m == nil {
+		return
+	}
+	m.RetryTotal.WithLabelValues(topic).Inc()
+}
+
+// ObserveDead 记录一次进入死信队列，topic为消息的源主题。
+func (m *Metrics) ObserveDead(topic string) {
+	if m == nil {
+		return
+	}
+	m.DeadTotal.WithLabelValues(topic).Inc()
+}
+
+// ObserveExpired 记录一条过期未处理的消息。
+func (m *Metrics) ObserveExpired(topic, group string) {
+	if m == nil {
+		return
+	}
+	m.ExpiredTotal.WithLabelValues(topic, group).Inc()
+}
+
+// ObserveFiltered 记录一条被过滤或未匹配路由的消息。
+func (m *Metrics) ObserveFiltered(topic, group string) {
+	if m == nil {
+		return
+	}
+	m.FilteredTotal.WithLabelValues(topic, group).Inc()
+}
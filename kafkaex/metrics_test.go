@@ -0,0 +1,93 @@
+package kafkaex
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnableMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := EnableMetrics(reg, "test")
+	assert.Nil(t, err)
+	defer SetMetrics(nil)
+	assert.Equal(t, m, getMetrics())
+
+	// 重复注册应返回错误
+	_, err = EnableMetrics(reg, "test")
+	assert.NotNil(t, err)
+}
+
+func TestMetricsNil(t *testing.T) {
+	var m *Metrics
+	// nil采集器的所有方法都可以安全调用
+	m.ObservePublish("t", time.Now(), nil)
+	m.ObserveRetry("t")
+	m.ObserveDead("t")
+	m.HandleStart("t", "g", 0)(nil)
+}
+
+func TestMetricsPublish(t *testing.T) {
+	m := NewMetrics("test")
+	m.ObservePublish("topic1", time.Now(), nil)
+	m.ObservePublish("topic1", time.Now(), errors.New("fail"))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.PublishTotal.WithLabelValues("topic1")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.PublishErrors.WithLabelValues("topic1")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.PublishDuration))
+}
+
+func TestMetricsErrExec(t *testing.T) {
+	m := NewMetrics("test")
+	SetMetrics(m)
+	defer SetMetrics(nil)
+	publish := func(string, *BoxMessage) error { return nil }
+
+	box := NewBoxMessage().WithOption(WithTopic("topic1"), WithRetryMax(2))
+	assert.Nil(t, ErrExec("topic1", "execer", box, errors.New("fail"), publish))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.RetryTotal.WithLabelValues("topic1")))
+
+	box.RetryIndex = 2
+	assert.Nil(t, ErrExec("topic1", "execer", box, errors.New("fail"), publish))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.DeadTotal.WithLabelValues("topic1")))
+
+	// 重试队列中再次失败，按源主题计入死信
+	assert.Nil(t, ErrExec(APHMQITP_RETRY, "execer", box, errors.New("fail"), publish))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.DeadTotal.WithLabelValues("topic1")))
+}
+
+func TestMetricsProcess(t *testing.T) {
+	m := NewMetrics("test")
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	var inFlight float64
+	process, err := processHanlder(GetManager(), "topic1", "execer", NewOptions(WithGroup("group1"), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		inFlight = testutil.ToFloat64(m.InFlight.WithLabelValues("topic1", "group1"))
+		return nil
+	})))
+	assert.Nil(t, err)
+
+	box := NewBoxMessage()
+	box.PublishAt = time.Now().Add(-time.Second).UnixMilli()
+	msg := box.NewRawMessage()
+	assert.Equal(t, cast.ToString(box.PublishAt), msg.Metadata.Get(APHMQH_PUBLISH_AT))
+
+	ch := make(chan *message.Message, 1)
+	ch <- msg
+	close(ch)
+	process(context.Background(), ch)
+
+	assert.Equal(t, float64(1), inFlight)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.InFlight.WithLabelValues("topic1", "group1")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.ConsumeTotal.WithLabelValues("topic1", "group1")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.ConsumeErrors.WithLabelValues("topic1", "group1")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.EndToEnd))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.HandleDuration))
+}
@@ -0,0 +1,122 @@
+package kafkaex
+
+import (
+	"context"
+	"strings"
+)
+
+// defTopicNaming 重试与死信主题的命名模板，默认使用共享的内置主题。
+var defTopicNaming TopicNaming
+
+// TopicNaming 定义了重试与死信主题及其内置消费组的命名模板，支持{topic}（源主题）与{group}（消费失败的组别）占位符。
+// 模板为空时使用共享的内置主题APHMQITP_RETRY、APHMQITP_DEAD与内置组别APHMQIGP_INNER。
+type TopicNaming struct {
+	Retry string // 重试主题模板，如{topic}.retry
+	Dead  string // 死信主题模板，如{group}.{topic}.dlq
+	Group string // 消费重试与死信主题的组别模板，如{group}.inner
+}
+
+// SetTopicNaming 设置重试与死信主题的命名模板。设置后RegisterSubscriber会为每个订阅自动注册对应的重试与死信消费，
+// 共享的内置主题仍由RegisterRetry、RegisterDead订阅，以兼容存量消息。
+func SetTopicNaming(n TopicNaming) {
+	defTopicNaming = n
+}
+
+// RetryTopic 返回源主题与组别对应的重试主题。
+func RetryTopic(topic, group string) string {
+	return renderTopicName(defTopicNaming.Retry, APHMQITP_RETRY, topic, group)
+}
+
+// DeadTopic 返回源主题与组别对应的死信主题。
+func DeadTopic(topic, group string) string {
+	return renderTopicName(defTopicNaming.Dead, APHMQITP_DEAD, topic, group)
+}
+
+// InnerGroup 返回消费源主题与组别对应的重试与死信主题的组别。
+func InnerGroup(topic, group string) string {
+	return renderTopicName(defTopicNaming.Group, APHMQIGP_INNER, topic, group)
+}
+
+// renderTopicName 使用源主题与组别替换模板中的占位符，模板为空时返回默认值。
+func renderTopicName(tpl, def, topic, group string) string {
+	if tpl == "" {
+		return def
+	}
+	return strings.NewReplacer("{topic}", topic, "{group}", group).Replace(tpl)
+}
+
+// isInnerTopic 判断订阅的主题是否为消息对应的重试或死信主题，共享的内置主题始终视为内部主题。
+func isInnerTopic(topic string, box *BoxMessage) bool {
+	if topic == APHMQITP_RETRY || topic == APHMQITP_DEAD {
+		return true
+	}
+	if box.Topic == "" || box.Topic == topic {
+		return false
+	}
+	return topic == RetryTopic(box.Topic, box.ExecGroup) || topic == DeadTopic(box.Topic, box.ExecGroup)
+}
+
+// isDeadTopic 判断订阅的主题是否为消息对应的死信主题，共享的内置死信主题始终视为死信主题。
+func isDeadTopic(topic string, box *BoxMessage) bool {
+	if topic == APHMQITP_DEAD {
+		return true
+	}
+	return box.Topic != "" && box.Topic != topic && topic == DeadTopic(box.Topic, box.ExecGroup)
+}
+
+// innerOrigin 定义了需要自动注册重试与死信消费的源订阅。
+type innerOrigin struct {
+	topic string
+	group string
+}
+
+// registerInner 为源订阅注册按模板命名的重试与死信消费，同一主题只订阅一次。
+// 重试与死信处理程序尚未注册时先记录源订阅，待RegisterRetry、RegisterDead时补充注册。
+func (m *WaterMillManager) registerInner(ctx context.Context, origins ...innerOrigin) error {
+	m.innerMu.Lock()
+	defer m.innerMu.Unlock()
+	if m.innerTopics == nil {
+		m.innerTopics = map[string]bool{}
+	}
+	for _, o := range origins {
+		if o.group == "" {
+			continue
+		}
+		if !m.hasOrigin(o) {
+			m.innerOrigins = append(m.innerOrigins, o)
+		}
+		if defTopicNaming.Retry != "" && m.retryHandle != nil {
+			if err := m.subscribeInner(ctx, RetryTopic(o.topic, o.group), InnerGroup(o.topic, o.group), m.retryHandle); err != nil {
+				return err
+			}
+		}
+		if defTopicNaming.Dead != "" && m.deadHandle != nil {
+			if err := m.subscribeInner(ctx, DeadTopic(o.topic, o.group), InnerGroup(o.topic, o.group), m.deadHandle); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// subscribeInner 订阅重试或死信主题，已订阅的主题直接跳过。
+func (m *WaterMillManager) subscribeInner(ctx context.Context, topic, group string, h Handler) error {
+	if m.innerTopics[topic] {
+		return nil
+	}
+	if _, err := m.subscribe(ctx, topic, WithGroup(group), WithTopic(topic), WithHandle(h)); err != nil {
+		return err
+	}
+	m.innerTopics[topic] = true
+	return nil
+}
+
+// hasOrigin 判断源订阅是否已记录。
+func (m *WaterMillManager) hasOrigin(o innerOrigin) bool {
+	for _, v := range m.innerOrigins {
+		if v == o {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package kafkaex
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicNaming(t *testing.T) {
+	// 未设置模板时使用共享的内置主题
+	assert.Equal(t, APHMQITP_RETRY, RetryTopic("orders", "billing"))
+	assert.Equal(t, APHMQITP_DEAD, DeadTopic("orders", "billing"))
+	assert.Equal(t, APHMQIGP_INNER, InnerGroup("orders", "billing"))
+
+	SetTopicNaming(TopicNaming{Retry: "{topic}.retry", Dead: "{group}.{topic}.dlq", Group: "{group}.inner"})
+	defer SetTopicNaming(TopicNaming{})
+	assert.Equal(t, "orders.retry", RetryTopic("orders", "billing"))
+	assert.Equal(t, "billing.orders.dlq", DeadTopic("orders", "billing"))
+	assert.Equal(t, "billing.inner", InnerGroup("orders", "billing"))
+
+	box := &BoxMessage{Options: Options{Topic: "orders"}, ExecGroup: "billing"}
+	assert.True(t, isInnerTopic("orders.retry", box))
+	assert.True(t, isInnerTopic("billing.orders.dlq", box))
+	assert.True(t, isInnerTopic(APHMQITP_RETRY, box))
+	assert.False(t, isInnerTopic("orders", box))
+	assert.False(t, isInnerTopic("payments.retry", box))
+}
+
+func TestRetryTargets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	handle := WithHandle(func(ctx context.Context, box *BoxMessage) error { return nil })
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithGroup("billing"), handle))
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithGroup("shipping"), handle))
+	// 未设置模板时查询共享的内置重试主题
+	assert.Equal(t, []innerOrigin{{topic: APHMQITP_RETRY, group: APHMQIGP_INNER}}, m.retryTargets())
+
+	SetTopicNaming(TopicNaming{Retry: "{group}.{topic}.retry", Group: "{group}.inner"})
+	defer SetTopicNaming(TopicNaming{})
+	assert.Equal(t, []innerOrigin{
+		{topic: "billing.orders.retry", group: "billing.inner"},
+		{topic: "shipping.orders.retry", group: "shipping.inner"},
+	}, m.retryTargets())
+}
+
+func TestErrExecTopicNaming(t *testing.T) {
+	SetTopicNaming(TopicNaming{Retry: "{topic}.retry", Dead: "{group}.{topic}.dlq"})
+	defer SetTopicNaming(TopicNaming{})
+	published := []string{}
+	publish := func(topic string, box *BoxMessage) error {
+		published = append(published, topic)
+		return nil
+	}
+	box := &BoxMessage{Options: Options{Group: "billing", RetryMax: 1}}
+	// 源主题失败进入重试主题，组别缺省取Group
+	assert.Nil(t, ErrExec("orders", "node,billing", box, errors.New("fail"), publish))
+	assert.Equal(t, "billing", box.ExecGroup)
+	// 重试主题失败进入死信主题
+	assert.Nil(t, ErrExec("orders.retry", "node,inner", box, errors.New("fail"), publish))
+	assert.Equal(t, []string{"orders.retry", "billing.orders.dlq"}, published)
+	// 执行结果保留源主题的失败信息
+	assert.Equal(t, "node,billing", box.Execer)
+}
+
+func TestMemoryManagerTopicNaming(t *testing.T) {
+	SetRetryDelay(time.Millisecond)
+	defer SetRetryDelay(0)
+	SetTopicNaming(TopicNaming{Retry: "{topic}.retry", Dead: "{group}.{topic}.dlq", Group: "{group}.inner"})
+	defer SetTopicNaming(TopicNaming{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := NewMemoryManager()
+	dead := make(chan *BoxMessage, 2)
+	// 先注册重试与死信，再注册订阅，自动补充按模板命名的消费
+	assert.Nil(t, m.RegisterRetry(ctx, nil))
+	assert.Nil(t, m.RegisterDead(ctx, func(ctx context.Context, box *BoxMessage) error {
+		dead <- box
+		return nil
+	}))
+	assert.Nil(t, m.RegisterSubscriber(ctx, "orders", WithGroup("billing"), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		return errors.New("fail")
+	})))
+
+	box := NewBoxMessage().WithOption(WithRetryMax(1))
+	box.Value = []byte("hello")
+	assert.Nil(t, m.Publish("orders", box))
+	select {
+	case got := <-dead:
+		assert.Equal(t, "orders", got.Topic)
+		assert.Equal(t, "billing", got.ExecGroup)
+		assert.Equal(t, int64(1), got.RetryIndex)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for dead letter")
+	}
+
+	// 共享的内置死信主题仍可消费
+	legacy := NewBoxMessage()
+	legacy.Topic = "legacy"
+	assert.Nil(t, m.Publish(APHMQITP_DEAD, legacy))
+	select {
+	case got := <-dead:
+		assert.Equal(t, "legacy", got.Topic)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for legacy dead letter")
+	}
+}
@@ -0,0 +1,214 @@
+package kafkaex
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// defDeadNotifier 默认的死信通知器，设置后RegisterDead注册的死信消费会触发通知。
+var defDeadNotifier *DeadNotifier
+
+// SetDeadNotifier 设置默认的死信通知器，传入nil则关闭通知。
+func SetDeadNotifier(n *DeadNotifier) {
+	defDeadNotifier = n
+}
+
+// DefaultNoticeTemplate 默认的通知内容模板。
+const DefaultNoticeTemplate = `[kafkaex] 死信告警 topic={{.Topic}} group={{.Group}} count={{.Count}} attempts={{.Attempts}} err={{.ExecErr}}`
+
+// DeadNotice 定义了一条死信通知，窗口内相同的死信会聚合为一条。
+type DeadNotice struct {
+	Topic    string      `json:"topic"`    // 源主题
+	Group    string      `json:"group"`    // 消费失败的组别
+	ExecErr  string      `json:"execerr"`  // 执行错误信息
+	Execer   string      `json:"execer"`   // 执行者
+	MsgId    string      `json:"msgid"`    // 最后一条死信的消息ID
+	Attempts int64       `json:"attempts"` // 最后一条死信的执行次数
+	Count    int         `json:"count"`    // 窗口内聚合的死信数量
+	First    time.Time   `json:"first"`    // 窗口内第一条死信的时间
+	Last     time.Time   `json:"last"`     // 窗口内最后一条死信的时间
+	Box      *BoxMessage `json:"-"`        // 最后一条死信
+}
+
+// Notifier 定义了死信通知的发送接口，内置Webhook、邮件与日志实现。
+type Notifier interface {
+	Notify(ctx context.Context, notice *DeadNotice) error
+}
+
+// NotifyRule 定义了死信通知的路由规则，Topic与Group支持path.Match通配符，为空表示匹配全部。
+type NotifyRule struct {
+	Topic string     // 源主题匹配规则
+	Group string     // 消费失败的组别匹配规则
+	Sinks []Notifier // 匹配后发送的通知渠道
+}
+
+// Match 判断规则是否匹配死信。
+func (r *NotifyRule) Match(box *BoxMessage) bool {
+	return matchPattern(r.Topic, box.Topic) && matchPattern(r.Group, execGroup(box))
+}
+
+// DeadNotifier 死信通知器，按规则路由到通知渠道，并在窗口内对相同死信进行聚合去重。
+type DeadNotifier struct {
+	rules   []*NotifyRule
+	window  time.Duration
+	key     func(box *BoxMessage) string
+	mu      sync.Mutex
+	pending map[string]*pendingNotice
+}
+
+// pendingNotice 窗口内等待发送的聚合通知。
+type pendingNotice struct {
+	notice *DeadNotice
+	rule   *NotifyRule
+	timer  *time.Timer
+}
+
+// NewDeadNotifier 创建并返回一个新的DeadNotifier实例，window为聚合窗口，为0时每条死信立即通知。
+// 规则按顺序匹配，命中第一条后不再继续。
+func NewDeadNotifier(window time.Duration, rules ...*NotifyRule) *DeadNotifier {
+	return &DeadNotifier{
+		rules:   rules,
+		window:  window,
+		key:     defaultNoticeKey,
+		pending: map[string]*pendingNotice{},
+	}
+}
+
+// WithKey 设置聚合去重的键，默认按源主题、组别与错误信息聚合。
+func (n *DeadNotifier) WithKey(f func(box *BoxMessage) string) *DeadNotifier {
+	n.key = f
+	return n
+}
+
+// Observe 记录一条死信，窗口内首次出现时开始计时，窗口结束时发送聚合后的通知。
+func (n *DeadNotifier) Observe(ctx context.Context, box *BoxMessage) {
+	rule := n.route(box)
+	if rule == nil {
+		return
+	}
+	now := time.Now()
+	if n.window <= 0 {
+		notice := newDeadNotice(box, now)
+		n.send(ctx, rule, notice)
+		return
+	}
+	key := n.key(box)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if p, ok := n.pending[key]; ok {
+		p.notice.Count++
+		p.notice.Last = now
+		p.notice.MsgId = box.MsgId
+		p.notice.Attempts = box.RetryIndex + 1
+		p.notice.Box = box
+		return
+	}
+	p := &pendingNotice{notice: newDeadNotice(box, now), rule: rule}
+	p.timer = time.AfterFunc(n.window, func() {
+		n.flush(context.WithoutCancel(ctx), key)
+	})
+	n.pending[key] = p
+}
+
+// Close 立即发送窗口内全部待发送的通知。
+func (n *DeadNotifier) Close(ctx context.Context) {
+	n.mu.Lock()
+	keys := make([]string, 0, len(n.pending))
+	for k, p := range n.pending {
+		p.timer.Stop()
+		keys = append(keys, k)
+	}
+	n.mu.Unlock()
+	for _, k := range keys {
+		n.flush(ctx, k)
+	}
+}
+
+// flush 发送并移除指定键的聚合通知。
+func (n *DeadNotifier) flush(ctx context.Context, key string) {
+	n.mu.Lock()
+	p, ok := n.pending[key]
+	delete(n.pending, key)
+	n.mu.Unlock()
+	if ok {
+		n.send(ctx, p.rule, p.notice)
+	}
+}
+
+// send 将通知发送到规则的全部渠道，单个渠道失败不影响其他渠道。
+func (n *DeadNotifier) send(ctx context.Context, rule *NotifyRule, notice *DeadNotice) {
+	for _, sink := range rule.Sinks {
+		if err := sink.Notify(ctx, notice); err != nil {
+			deflog.ErrorCtx(ctx, "死信通知发送失败%v", err)
+		}
+	}
+}
+
+// route 返回第一条匹配的规则。
+func (n *DeadNotifier) route(box *BoxMessage) *NotifyRule {
+	for _, r := range n.rules {
+		if r.Match(box) {
+			return r
+		}
+	}
+	return nil
+}
+
+// withDeadNotify 为死信处理函数附加通知。
+func withDeadNotify(h Handler) Handler {
+	return func(ctx context.Context, box *BoxMessage) error {
+		if n := defDeadNotifier; n != nil {
+			n.Observe(ctx, box)
+		}
+		return h(ctx, box)
+	}
+}
+
+// newDeadNotice 根据死信创建通知。
+func newDeadNotice(box *BoxMessage, at time.Time) *DeadNotice {
+	return &DeadNotice{
+		Topic:    box.Topic,
+		Group:    execGroup(box),
+		ExecErr:  box.ExecErr,
+		Execer:   box.Execer,
+		MsgId:    box.MsgId,
+		Attempts: box.RetryIndex + 1,
+		Count:    1,
+		First:    at,
+		Last:     at,
+		Box:      box,
+	}
+}
+
+// defaultNoticeKey 默认的聚合键，按源主题、组别与错误信息聚合。
+func defaultNoticeKey(box *BoxMessage) string {
+	return box.Topic + "\x00" + execGroup(box) + "\x00" + box.ExecErr
+}
+
+// matchPattern 使用path.Match匹配，规则为空时匹配全部。
+func matchPattern(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(pattern, s)
+	return err == nil && ok
+}
+
+// RenderNotice 使用模板渲染通知内容，tpl为空时使用DefaultNoticeTemplate。
+func RenderNotice(tpl *template.Template, notice *DeadNotice) (string, error) {
+	if tpl == nil {
+		tpl = defaultNoticeTpl
+	}
+	buf := &bytes.Buffer{}
+	if err := tpl.Execute(buf, notice); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// defaultNoticeTpl 默认的通知内容模板。
+var defaultNoticeTpl = template.Must(template.New("notice").Parse(DefaultNoticeTemplate))
@@ -0,0 +1,118 @@
+package kafkaex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// LogSink 将死信通知输出到日志。
+type LogSink struct {
+	Template *template.Template // 通知内容模板，为空时使用DefaultNoticeTemplate
+}
+
+// Notify 实现Notifier接口。
+func (s *LogSink) Notify(ctx context.Context, notice *DeadNotice) error {
+	msg, err := RenderNotice(s.Template, notice)
+	if err != nil {
+		return err
+	}
+	deflog.ErrorCtx(ctx, "%s", msg)
+	return nil
+}
+
+// WebhookSink 通过HTTP POST发送死信通知。
+type WebhookSink struct {
+	URL         string             // 通知地址
+	Template    *template.Template // 请求体模板，为空时发送DeadNotice的JSON
+	ContentType string             // 请求体类型，为空时为application/json
+	Client      *http.Client       // HTTP客户端，为空时使用10秒超时的默认客户端
+}
+
+// Notify 实现Notifier接口，响应状态码非2xx时返回错误。
+func (s *WebhookSink) Notify(ctx context.Context, notice *DeadNotice) error {
+	var body []byte
+	if s.Template != nil {
+		msg, err := RenderNotice(s.Template, notice)
+		if err != nil {
+			return err
+		}
+		body = []byte(msg)
+	} else {
+		bs, err := json.Marshal(notice)
+		if err != nil {
+			return err
+		}
+		body = bs
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	contentType := s.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s 返回状态码%d", s.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// EmailSink 通过SMTP发送死信通知邮件。
+type EmailSink struct {
+	Addr     string             // SMTP服务地址，如smtp.example.com:587
+	Auth     smtp.Auth          // SMTP认证，可为nil
+	From     string             // 发件人
+	To       []string           // 收件人
+	Subject  *template.Template // 邮件主题模板，为空时使用默认主题
+	Template *template.Template // 邮件正文模板，为空时使用DefaultNoticeTemplate
+	send     func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// Notify 实现Notifier接口。
+func (s *EmailSink) Notify(ctx context.Context, notice *DeadNotice) error {
+	subject := fmt.Sprintf("[kafkaex] 死信告警 %s", notice.Topic)
+	if s.Subject != nil {
+		v, err := RenderNotice(s.Subject, notice)
+		if err != nil {
+			return err
+		}
+		subject = v
+	}
+	body, err := RenderNotice(s.Template, notice)
+	if err != nil {
+		return err
+	}
+	msg := strings.Join([]string{
+		"From: " + s.From,
+		"To: " + strings.Join(s.To, ", "),
+		"Subject: " + mime.BEncoding.Encode("UTF-8", subject), // 按RFC 2047编码非ASCII主题
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+	send := s.send
+	if send == nil {
+		send = smtp.SendMail
+	}
+	return send(s.Addr, s.Auth, s.From, s.To, []byte(msg))
+}
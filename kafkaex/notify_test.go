@@ -0,0 +1,151 @@
+package kafkaex
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordSink 记录收到的通知，用于测试。
+type recordSink struct {
+	mu      sync.Mutex
+	notices []*DeadNotice
+}
+
+func (s *recordSink) Notify(ctx context.Context, notice *DeadNotice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notices = append(s.notices, notice)
+	return nil
+}
+
+func (s *recordSink) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.notices)
+}
+
+func TestDeadNotifierRouting(t *testing.T) {
+	orders, others := &recordSink{}, &recordSink{}
+	n := NewDeadNotifier(0,
+		&NotifyRule{Topic: "orders.*", Sinks: []Notifier{orders}},
+		&NotifyRule{Sinks: []Notifier{others}},
+	)
+	ctx := context.Background()
+	n.Observe(ctx, newDeadBox("1", "orders.created", "g1", "fail"))
+	n.Observe(ctx, newDeadBox("2", "users", "g1", "fail"))
+	assert.Equal(t, 1, orders.Len())
+	assert.Equal(t, 1, others.Len())
+	assert.Equal(t, int64(4), orders.notices[0].Attempts)
+}
+
+func TestDeadNotifierExecGroup(t *testing.T) {
+	billing, others := &recordSink{}, &recordSink{}
+	n := NewDeadNotifier(time.Hour,
+		&NotifyRule{Group: "billing", Sinks: []Notifier{billing}},
+		&NotifyRule{Sinks: []Notifier{others}},
+	)
+	ctx := context.Background()
+	// 生产者组别相同，按消费失败的组别路由与聚合
+	for _, group := range []string{"billing", "shipping", "shipping"} {
+		box := newDeadBox("1", "orders", "producer", "fail")
+		box.ExecGroup = group
+		n.Observe(ctx, box)
+	}
+	n.Close(ctx)
+	assert.Equal(t, 1, billing.Len())
+	assert.Equal(t, "billing", billing.notices[0].Group)
+	assert.Equal(t, 1, others.Len())
+	assert.Equal(t, "shipping", others.notices[0].Group)
+	assert.Equal(t, 2, others.notices[0].Count)
+}
+
+func TestDeadNotifierAggregate(t *testing.T) {
+	sink := &recordSink{}
+	n := NewDeadNotifier(time.Hour, &NotifyRule{Sinks: []Notifier{sink}})
+	ctx := context.Background()
+	for i := 0; i < 10000; i++ {
+		n.Observe(ctx, newDeadBox("1", "orders", "g1", "db timeout"))
+	}
+	n.Observe(ctx, newDeadBox("2", "orders", "g1", "invalid payload"))
+	assert.Equal(t, 0, sink.Len())
+
+	n.Close(ctx)
+	assert.Equal(t, 2, sink.Len())
+	counts := map[string]int{}
+	for _, notice := range sink.notices {
+		counts[notice.ExecErr] = notice.Count
+	}
+	assert.Equal(t, map[string]int{"db timeout": 10000, "invalid payload": 1}, counts)
+}
+
+func TestDeadNotifierWindow(t *testing.T) {
+	sink := &recordSink{}
+	n := NewDeadNotifier(20*time.Millisecond, &NotifyRule{Sinks: []Notifier{sink}})
+	SetDeadNotifier(n)
+	defer SetDeadNotifier(nil)
+
+	h := withDeadNotify(func(ctx context.Context, box *BoxMessage) error { return nil })
+	assert.Nil(t, h(context.Background(), newDeadBox("1", "orders", "g1", "fail")))
+	assert.Nil(t, h(context.Background(), newDeadBox("2", "orders", "g1", "fail")))
+	assert.Eventually(t, func() bool { return sink.Len() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 2, sink.notices[0].Count)
+	assert.Equal(t, "2", sink.notices[0].MsgId)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := io.ReadAll(r.Body)
+		body = string(bs)
+		if strings.Contains(body, "reject") {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	notice := newDeadNotice(newDeadBox("1", "orders", "g1", "db timeout"), time.Now())
+	sink := &WebhookSink{URL: srv.URL}
+	assert.Nil(t, sink.Notify(context.Background(), notice))
+	assert.Contains(t, body, `"execerr":"db timeout"`)
+
+	sink.Template = template.Must(template.New("t").Parse(`{"text":"{{.Topic}} {{.ExecErr}}"}`))
+	assert.Nil(t, sink.Notify(context.Background(), notice))
+	assert.Equal(t, `{"text":"orders db timeout"}`, body)
+
+	notice.ExecErr = "reject"
+	assert.NotNil(t, sink.Notify(context.Background(), notice))
+}
+
+func TestEmailSink(t *testing.T) {
+	var sent string
+	sink := &EmailSink{
+		Addr: "smtp.example.com:25",
+		From: "kafkaex@example.com",
+		To:   []string{"oncall@example.com"},
+		send: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			sent = string(msg)
+			return nil
+		},
+	}
+	notice := newDeadNotice(newDeadBox("1", "orders", "g1", "db timeout"), time.Now())
+	assert.Nil(t, sink.Notify(context.Background(), notice))
+	subject := mime.BEncoding.Encode("UTF-8", "[kafkaex] 死信告警 orders")
+	assert.Contains(t, sent, "Subject: "+subject+"\r\n")
+	decoded, err := new(mime.WordDecoder).DecodeHeader(subject)
+	assert.Nil(t, err)
+	assert.Equal(t, "[kafkaex] 死信告警 orders", decoded)
+	assert.Contains(t, sent, "topic=orders group=g1 count=1 attempts=4 err=db timeout")
+
+	assert.Nil(t, (&LogSink{}).Notify(context.Background(), notice))
+}
@@ -18,6 +18,14 @@ type Options struct {
 	ExecType      int32                               `json:"exectype" form:"exectype"`     // 0：普通消费，1-阻塞消费
 	Handle        Handler                             `json:"-" form:"-"`                   // 消息处理函数
 	HandleTimeout time.Duration                       `json:"timeout" form:"timeout"`       // 处理超时时间
+	Interop       bool                                `json:"-" form:"-"`                   // 兼容模式，以订阅配置补全外部生产者的消息
+	Breaker       *CircuitBreaker                     `json:"-" form:"-"`                   // 熔断器，处理持续失败时暂停消费
+	Limiter       *KeyedLimiter                       `json:"-" form:"-"`                   // 令牌桶限流
+	DeliverAt     int64                               `json:"deliverat" form:"deliverat"`   // 投递时间戳(毫秒)，晚于当前时间时由延迟调度器投递
+	ExpireAt      int64                               `json:"expireat" form:"expireat"`     // 过期时间戳(毫秒)，过期的消息不再处理
+	OnExpired     Handler                             `json:"-" form:"-"`                   // 过期消息的处理函数
+	EventType     string                              `json:"evtype" form:"evtype"`         // 事件类型，用于按类型过滤与路由
+	Filter        func(box *BoxMessage) bool          `json:"-" form:"-"`                   // 消息过滤，返回false的消息确认后跳过
 }
 
 // Fmt 检查并设置Options的默认值
@@ -127,3 +135,87 @@ func WithHandleTimeout(timeout time.Duration) Option {
 		o.HandleTimeout = timeout
 	}
 }
+
+// WithInterop 开启兼容模式，消息不含内置消息头时以消费记录与订阅配置（组别、最大重试次数、超时等）补全信封
+func WithInterop() Option {
+	return func(o *Options) {
+		o.Interop = true
+	}
+}
+
+// WithCircuitBreaker 开启订阅熔断，最近window条消息的失败率达到threshold时暂停消费，冷却cooldown后以一条消息探测，熔断期间消息保留在源主题，
+// opts可通过WithBreakerProbes开启毒消息处理，同一消息探测失败达到上限后进入重试与死信
+func WithCircuitBreaker(threshold float64, window int, cooldown time.Duration, opts ...BreakerOption) Option {
+	return func(o *Options) {
+		o.Breaker = NewCircuitBreaker(threshold, window, cooldown, opts...)
+	}
+}
+
+// WithRateLimit 开启订阅限流，每秒处理rps条消息，突发burst条
+func WithRateLimit(rps float64, burst int) Option {
+	return func(o *Options) {
+		o.Limiter = NewKeyedLimiter(rps, burst, nil)
+	}
+}
+
+// WithKeyedRateLimit 开启按键限流，key返回的每个键每秒处理rps条消息，突发burst条，如LimitByKey、LimitByHeader("tenant")
+func WithKeyedRateLimit(rps float64, burst int, key func(box *BoxMessage) string) Option {
+	return func(o *Options) {
+		o.Limiter = NewKeyedLimiter(rps, burst, key)
+	}
+}
+
+// WithDeliverAt 设置消息在指定时间投递，需要管理器配置延迟调度器
+func WithDeliverAt(t time.Time) Option {
+	return func(o *Options) {
+		o.DeliverAt = t.UnixMilli()
+	}
+}
+
+// WithDelay 设置消息延迟指定时长后投递，需要管理器配置延迟调度器
+func WithDelay(d time.Duration) Option {
+	return func(o *Options) {
+		o.DeliverAt = time.Now().Add(d).UnixMilli()
+	}
+}
+
+// WithTTL 设置消息的有效时长，超过后消费时不再处理
+func WithTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.ExpireAt = time.Now().Add(ttl).UnixMilli()
+	}
+}
+
+// WithExpireAt 设置消息的过期时间，超过后消费时不再处理
+func WithExpireAt(t time.Time) Option {
+	return func(o *Options) {
+		o.ExpireAt = t.UnixMilli()
+	}
+}
+
+// WithExpiredHandle 设置订阅中过期消息的处理函数，如ExpiredDrop、ExpiredToDead或自定义回调，未设置时使用SetExpiredHandle的配置
+func WithExpiredHandle(h Handler) Option {
+	return func(o *Options) {
+		o.OnExpired = h
+	}
+}
+
+// WithEventType 设置消息的事件类型，消费方可按类型过滤或路由
+func WithEventType(eventType string) Option {
+	return func(o *Options) {
+		o.EventType = eventType
+	}
+}
+
+// WithFilter 设置订阅的消息过滤，多次设置时需全部满足，不满足的消息确认后跳过，不计为失败
+func WithFilter(filter func(box *BoxMessage) bool) Option {
+	return func(o *Options) {
+		if prev := o.Filter; prev != nil {
+			o.Filter = func(box *BoxMessage) bool {
+				return prev(box) && filter(box)
+			}
+			return
+		}
+		o.Filter = filter
+	}
+}
@@ -2,6 +2,7 @@ package kafkaex
 
 import (
 	"context"
+	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
@@ -13,16 +14,33 @@ func (m *WaterMillManager) Publish(topic string, boxM *BoxMessage) error {
 	return m.RawPublish(topic, boxM, nil)
 }
 
-// RawPublish 将消息发布到指定的主题。
+// RawPublish 将消息发布到指定的主题。投递时间晚于当前时间的消息交给延迟调度器，到期后再发布。
 func (m *WaterMillManager) RawPublish(topic string, boxM *BoxMessage, ow func(*sarama.Config) *sarama.Config) error {
+	if boxM.DeliverAt > time.Now().UnixMilli() {
+		if m.scheduler == nil {
+			return ErrNoFoundScheduler
+		}
+		return m.scheduler.Schedule(context.Background(), topic, boxM)
+	}
 	// 尝试从缓存中获取或创建一个新的发布者
-	pub := m.Pubs.GetOrSet(boxM.Group, func(key string) (*kafka.Publisher, error) {
-		return NewPublisher(topic, ow)
+	pub := m.pubs.GetOrSet(boxM.Group, func(key string) (*message.Publisher, error) {
+		p, err := m.newPublisher(topic, ow)
+		if kp, ok := p.(*kafka.Publisher); ok && kp != nil {
+			m.Pubs.SetItem(key, kp)
+		}
+		return &p, err
 	})
 	if pub == nil {
+		getMetrics().ObservePublish(topic, time.Now(), ErrNoFoundPublisher)
 		return ErrNoFoundPublisher // 如果无法获取发布者，则返回错误
 	}
-	return pub.Publish(topic, boxM.NewRawMessage()) // 调用发布者发布消息
+	span := startPublishSpan(topic, boxM) // 创建发布Span并注入消息头
+	begin := time.Now()
+	boxM.PublishAt = begin.UnixMilli()                 // 记录发布时间，用于计算端到端延迟
+	err := (*pub).Publish(topic, boxM.NewRawMessage()) // 调用发布者发布消息
+	getMetrics().ObservePublish(topic, begin, err)
+	endSpan(span, err)
+	return err
 }
 
 // NewPublisher 创建并返回一个新的Kafka发布者实例。
@@ -0,0 +1,108 @@
+package kafkaex
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// routerCallKey 消息上下文中保存本次处理信封的键。
+type routerCallKey struct{}
+
+// routerCall 路由处理程序的一次处理，供RouterMiddleware发送重试与死信。
+type routerCall struct {
+	topic    string
+	executer string
+	box      *BoxMessage
+}
+
+// NewRouter 创建一个watermill路由，并添加RouterMiddleware作为最外层的中间件，
+// 之后添加的中间件(如Retry、Throttle、Deduplicator)在其内部执行，处理程序最终失败时进入kafkaex的重试与死信。
+func (m *WaterMillManager) NewRouter(cfg message.RouterConfig) (*message.Router, error) {
+	router, err := message.NewRouter(cfg, NewWaterMillLogger())
+	if err != nil {
+		return nil, err
+	}
+	router.AddMiddleware(m.RouterMiddleware)
+	return router, nil
+}
+
+// RouterMiddleware 将AddRouterHandler注册的处理程序的失败按信封发送到重试或死信主题后确认，阻塞策略的消息不确认，由订阅者重新投递。
+// 需作为路由的第一个中间件添加，其他处理程序的错误原样返回。
+func (m *WaterMillManager) RouterMiddleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		msgs, err := h(msg)
+		if err == nil {
+			return msgs, nil
+		}
+		call, ok := msg.Context().Value(routerCallKey{}).(*routerCall)
+		if !ok {
+			return msgs, err
+		}
+		if call.box.Blocked() {
+			deflog.ErrorCtx(msg.Context(), "消费使用阻塞策略,无法进入重试以及死信队列%v", err)
+			return nil, err
+		}
+		call.box.WithContext(msg.Context())
+		if subErr := ErrExec(call.topic, call.executer, call.box, err, m.Publish); subErr != nil {
+			deflog.ErrorCtx(msg.Context(), "发送错误消息至处理队列失败%v", subErr)
+			return nil, subErr // 未能发送时不确认，由订阅者重新投递
+		}
+		return nil, nil
+	}
+}
+
+// AddRouterHandler 将订阅注册为路由的处理程序，处理程序名为"主题/组别"，消息以BoxMessage信封交给WithHandle设置的处理函数。
+// 支持过滤、过期、限流与并发上限，熔断与暂停请使用watermill的中间件。设置了命名模板时同样注册该订阅对应的重试与死信消费。
+// 路由关闭时会关闭处理程序的订阅者，因此每个处理程序使用独立创建的订阅者。
+func (m *WaterMillManager) AddRouterHandler(ctx context.Context, router *message.Router, topic string, opts ...Option) (*message.Handler, error) {
+	opt := NewOptions(opts...)
+	if opt.Topic == "" {
+		opt.Topic = topic
+	}
+	if err := opt.Fmt().Verify(); err != nil {
+		return nil, err
+	}
+	if opt.Handle == nil {
+		return nil, ErrNoFoundHandle
+	}
+	sub, err := m.newSubscriber(opt.Group, opt.Overwrite)
+	if err != nil {
+		return nil, err
+	}
+	executer := fmt.Sprintf("%s,%s", getName(), opt.Group)
+	handler := router.AddNoPublisherHandler(fmt.Sprintf("%s/%s", topic, opt.Group), topic, sub, m.routerHandler(topic, executer, opt))
+	if err := m.registerInner(ctx, innerOrigin{topic: topic, group: opt.Group}); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+// routerHandler 创建处理一条消息的路由处理函数，返回处理函数的错误，由中间件决定重试或确认。
+func (m *WaterMillManager) routerHandler(topic, executer string, opt *Options) message.NoPublishHandlerFunc {
+	return func(msg *message.Message) error {
+		ctx := msg.Context()
+		box := consumeBox(topic, opt, msg)
+		if skipConsume(ctx, topic, opt, box) {
+			return nil
+		}
+		if opt.Limiter != nil {
+			if err := opt.Limiter.Wait(ctx, box); err != nil {
+				return err
+			}
+		}
+		release, err := m.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		spanCtx, span := startConsumeSpan(ctx, topic, opt.Group, box)
+		done := getMetrics().HandleStart(topic, opt.Group, box.PublishAt)
+		err = invoke(spanCtx, box, opt.Handle)
+		done(err)
+		endSpan(span, err)
+		msg.SetContext(context.WithValue(ctx, routerCallKey{}, &routerCall{topic: topic, executer: executer, box: box}))
+		return err
+	}
+}
@@ -0,0 +1,68 @@
+package kafkaex
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	router, err := m.NewRouter(message.RouterConfig{})
+	assert.Nil(t, err)
+	// 路由中间件先在内部重试，仍失败时进入kafkaex的重试队列
+	router.AddMiddleware(middleware.Retry{MaxRetries: 2}.Middleware)
+
+	var attempts atomic.Int32
+	got := make(chan string, 10)
+	handler, err := m.AddRouterHandler(ctx, router, "orders", WithGroup("g1"), WithEventTypes("created"),
+		WithHandle(func(ctx context.Context, box *BoxMessage) error {
+			if string(box.Value) == "bad" {
+				attempts.Add(1)
+				return errors.New("bad order")
+			}
+			got <- string(box.Value)
+			return nil
+		}))
+	assert.Nil(t, err)
+	assert.NotNil(t, handler)
+	retries := make(chan *BoxMessage, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, APHMQITP_RETRY, WithGroup(APHMQIGP_INNER), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		retries <- box
+		return nil
+	})))
+
+	go func() { _ = router.Run(ctx) }()
+	<-router.Running()
+	defer router.Close()
+
+	for _, v := range []string{"good", "bad"} {
+		box := NewBoxMessage().WithOption(WithEventType("created"), WithRetryMax(3))
+		box.Value = []byte(v)
+		assert.Nil(t, m.Publish("orders", box))
+	}
+	ignored := NewBoxMessage().WithOption(WithEventType("deleted"))
+	ignored.Value = []byte("ignored")
+	assert.Nil(t, m.Publish("orders", ignored))
+
+	assert.Equal(t, "good", <-got)
+	select {
+	case box := <-retries:
+		assert.Equal(t, "bad", string(box.Value))
+		assert.Equal(t, "orders", box.Topic)
+		assert.Equal(t, "g1", box.ExecGroup)
+		assert.Equal(t, "bad order", box.ExecErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for retry message")
+	}
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Len(t, got, 0)
+}
@@ -0,0 +1,145 @@
+package kafkaex
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// Responder 请求的处理函数，返回的消息作为响应发送给请求方，返回错误时响应中携带执行错误。
+type Responder func(ctx context.Context, req *BoxMessage) (*BoxMessage, error)
+
+// WithReplyTopic 设置接收响应的主题，默认为节点名加实例标识，多个实例不能共用同一个响应主题，同一进程内的多个管理器需分别设置。
+func WithReplyTopic(topic string) ManagerOption {
+	return func(m *WaterMillManager) {
+		m.replyTopic = topic
+	}
+}
+
+// ReplyTopic 返回接收响应的主题，未设置时为{节点名}.reply.{实例标识}，实例标识依次取环境变量POD_NAME、HOSTNAME与主机名，
+// 主机名稳定时（如StatefulSet）重启后复用同一主题与消费组。响应主题与同名的消费组不会自动删除，实例缩容或更换主机名后需清理，
+// 如使用kafka-topics.sh --delete与kafka-consumer-groups.sh --delete，或为响应主题设置较短的retention.ms。
+func (m *WaterMillManager) ReplyTopic() string {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	if m.replyTopic == "" {
+		m.replyTopic = fmt.Sprintf("%s.reply.%s", getName(), replyInstance())
+	}
+	return m.replyTopic
+}
+
+// replyInstance 返回实例的稳定标识，依次取环境变量POD_NAME、HOSTNAME与主机名，均为空时使用随机值。
+func replyInstance() string {
+	for _, key := range []string{"POD_NAME", "HOSTNAME"} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	if v, err := os.Hostname(); err == nil && v != "" {
+		return v
+	}
+	return watermill.NewShortUUID()
+}
+
+// StartReplies 订阅实例的响应主题，直到ctx结束，需在Request之前调用。已订阅时直接返回，订阅失败或ctx结束后可再次调用。
+func (m *WaterMillManager) StartReplies(ctx context.Context) error {
+	m.replyMu.Lock()
+	defer m.replyMu.Unlock()
+	if m.replying {
+		return nil
+	}
+	topic := m.ReplyTopic()
+	if _, err := m.subscribe(ctx, topic, WithGroup(topic), WithHandle(m.dispatchReply)); err != nil {
+		return err
+	}
+	m.replying = true
+	go func() {
+		<-ctx.Done()
+		m.replyMu.Lock()
+		m.replying = false
+		m.replyMu.Unlock()
+	}()
+	return nil
+}
+
+// Request 发布请求并等待响应，超时与取消由ctx控制，ctx设置了截止时间且请求未设置过期时间时以截止时间作为过期时间。
+// 需先调用StartReplies订阅响应主题，否则返回ErrNoFoundReplies，响应方处理失败时同时返回响应与ErrRemote。
+func (m *WaterMillManager) Request(ctx context.Context, topic string, box *BoxMessage) (*BoxMessage, error) {
+	m.replyMu.Lock()
+	replying := m.replying
+	m.replyMu.Unlock()
+	if !replying {
+		return nil, ErrNoFoundReplies
+	}
+	box.Correlation = watermill.NewUUID()
+	box.ReplyTo = m.ReplyTopic()
+	if deadline, ok := ctx.Deadline(); ok && box.ExpireAt == 0 {
+		box.ExpireAt = deadline.UnixMilli() // 请求方已放弃等待的请求无需处理
+	}
+	box.WithContext(ctx)
+	ch := make(chan *BoxMessage, 1)
+	m.pendingMu.Lock()
+	if m.pending == nil {
+		m.pending = map[string]chan *BoxMessage{}
+	}
+	m.pending[box.Correlation] = ch
+	m.pendingMu.Unlock()
+	defer func() {
+		m.pendingMu.Lock()
+		delete(m.pending, box.Correlation)
+		m.pendingMu.Unlock()
+	}()
+	if err := m.Publish(topic, box); err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-ch:
+		if reply.ExecErr != "" {
+			return reply, fmt.Errorf("%w: %s", ErrRemote, reply.ExecErr)
+		}
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RegisterResponder 注册请求的响应方，处理请求后将响应发布到请求的响应主题，未携带响应主题的消息仅处理不响应。
+// 处理失败时向请求方响应执行错误，不进入重试；响应发布失败时按订阅配置重试。
+func (m *WaterMillManager) RegisterResponder(ctx context.Context, topic string, h Responder, opts ...Option) error {
+	opts = append(opts, WithHandle(func(ctx context.Context, req *BoxMessage) error {
+		reply, err := h(ctx, req)
+		if req.ReplyTo == "" {
+			return err
+		}
+		if reply == nil {
+			reply = NewBoxMessage()
+		}
+		reply.Correlation = req.Correlation
+		if reply.SagaId == "" {
+			reply.SagaId = req.SagaId // 响应沿用请求所属的Saga实例
+		}
+		reply.ReplyTo, reply.ExecErr = "", ""
+		reply.ExecResult(getName(), err)
+		reply.WithContext(ctx)
+		return m.Publish(req.ReplyTo, reply)
+	}))
+	return m.RegisterSubscriber(ctx, topic, opts...)
+}
+
+// dispatchReply 将响应交给等待中的请求，请求已超时或取消时丢弃。
+func (m *WaterMillManager) dispatchReply(ctx context.Context, reply *BoxMessage) error {
+	m.pendingMu.Lock()
+	ch, ok := m.pending[reply.Correlation]
+	m.pendingMu.Unlock()
+	if !ok {
+		deflog.InfoCtx(ctx, "响应%s没有等待中的请求，丢弃", reply.Correlation)
+		return nil
+	}
+	select {
+	case ch <- reply:
+	default: // 重复投递的响应
+	}
+	return nil
+}
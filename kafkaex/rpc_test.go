@@ -0,0 +1,86 @@
+package kafkaex
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestReply(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager(WithReplyTopic("svc.reply.test")).(*WaterMillManager)
+	assert.Nil(t, m.RegisterResponder(ctx, "echo", func(ctx context.Context, req *BoxMessage) (*BoxMessage, error) {
+		if string(req.Value) == "bad" {
+			return nil, errors.New("bad request")
+		}
+		reply := NewBoxMessage()
+		reply.Value = append([]byte("echo:"), req.Value...)
+		return reply, nil
+	}))
+
+	reqCtx, reqCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer reqCancel()
+	_, err := m.Request(reqCtx, "echo", NewBoxMessage())
+	assert.Equal(t, ErrNoFoundReplies, err)
+	assert.Nil(t, m.StartReplies(ctx))
+	assert.Nil(t, m.StartReplies(ctx))
+	req := NewBoxMessage()
+	req.Value = []byte("hi")
+	reply, err := m.Request(reqCtx, "echo", req)
+	assert.Nil(t, err)
+	assert.Equal(t, "echo:hi", string(reply.Value))
+	assert.Equal(t, req.Correlation, reply.Correlation)
+	assert.Equal(t, "svc.reply.test", req.ReplyTo)
+	assert.NotZero(t, req.ExpireAt)
+
+	// 响应方处理失败时返回执行错误
+	bad := NewBoxMessage()
+	bad.Value = []byte("bad")
+	reply, err = m.Request(reqCtx, "echo", bad)
+	assert.ErrorIs(t, err, ErrRemote)
+	assert.Equal(t, "bad request", reply.ExecErr)
+
+	// 没有响应方时超时，并清理等待中的请求
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer timeoutCancel()
+	_, err = m.Request(timeoutCtx, "nobody", NewBoxMessage())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	m.pendingMu.Lock()
+	assert.Len(t, m.pending, 0)
+	m.pendingMu.Unlock()
+}
+
+func TestReplyTopicPerInstance(t *testing.T) {
+	t.Setenv("POD_NAME", "orders-0")
+	a := NewMemoryManager().(*WaterMillManager)
+	assert.Equal(t, "kafkaex.reply.orders-0", a.ReplyTopic())
+	assert.Equal(t, a.ReplyTopic(), a.ReplyTopic())
+	// 重启后使用同一个响应主题
+	b := NewMemoryManager().(*WaterMillManager)
+	assert.Equal(t, a.ReplyTopic(), b.ReplyTopic())
+
+	t.Setenv("POD_NAME", "")
+	t.Setenv("HOSTNAME", "orders-1")
+	assert.Equal(t, "kafkaex.reply.orders-1", NewMemoryManager().(*WaterMillManager).ReplyTopic())
+}
+
+func TestStartRepliesAfterCancel(t *testing.T) {
+	m := NewMemoryManager().(*WaterMillManager)
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.Nil(t, m.StartReplies(ctx))
+	cancel()
+	// ctx结束后需重新订阅
+	assert.Eventually(t, func() bool {
+		reqCtx, reqCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer reqCancel()
+		_, err := m.Request(reqCtx, "echo", NewBoxMessage())
+		return errors.Is(err, ErrNoFoundReplies)
+	}, time.Second, 5*time.Millisecond)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	assert.Nil(t, m.StartReplies(ctx))
+}
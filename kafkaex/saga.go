@@ -0,0 +1,273 @@
+package kafkaex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Saga实例状态
+const (
+	SagaRunning     = "running"     // SagaRunning 正在执行步骤
+	SagaCompleted   = "completed"   // SagaCompleted 全部步骤执行成功
+	SagaCompensated = "compensated" // SagaCompensated 步骤失败或超时，已发送补偿
+	SagaFailed      = "failed"      // SagaFailed 发送步骤命令失败
+)
+
+// SagaTimeoutEvent Saga步骤超时消息的事件类型。
+const SagaTimeoutEvent = "_saga_timeout"
+
+// SagaState 定义了一个Saga实例的持久化状态。
+type SagaState struct {
+	Id        string `json:"id" form:"id"`               // Saga实例ID
+	Name      string `json:"name" form:"name"`           // Saga定义名
+	Status    string `json:"status" form:"status"`       // 实例状态
+	Step      int    `json:"step" form:"step"`           // 当前步骤的序号
+	Data      []byte `json:"data" form:"data"`           // 业务数据，可在步骤响应时更新
+	Error     string `json:"error" form:"error"`         // 补偿或失败的原因
+	Version   int64  `json:"version" form:"version"`     // 版本号，用于并发修改检查
+	CreatedAt int64  `json:"createdat" form:"createdat"` // 创建时间戳(毫秒)
+	UpdatedAt int64  `json:"updatedat" form:"updatedat"` // 更新时间戳(毫秒)
+}
+
+// SagaStore 定义了Saga状态的持久化存储接口，内置SQL实现。
+type SagaStore interface {
+	// Create 保存一个新的Saga实例。
+	Create(ctx context.Context, s *SagaState) error
+	// Update 按版本号更新Saga实例并递增版本，版本不一致时返回ErrSagaConflict。
+	Update(ctx context.Context, s *SagaState) error
+	// Get 获取Saga实例，不存在时返回ErrNoFoundSaga。
+	Get(ctx context.Context, name, id string) (*SagaState, error)
+}
+
+// SagaStep 定义了Saga的一个步骤：向Topic发送命令，参与方处理后向Saga主题响应，失败时向CompensateTopic发送补偿命令。
+// 参与方可使用RegisterResponder自动响应，或发布携带命令SagaId的消息到命令的ReplyTo主题，处理失败时响应中设置执行错误。
+type SagaStep struct {
+	Name            string                                      // 步骤名
+	Topic           string                                      // 命令主题
+	Group           string                                      // 参与方消费命令的组别，用于监听对应的死信主题，为空时与主题相同
+	Command         func(s *SagaState) (*BoxMessage, error)     // 构建命令，为nil时以业务数据作为消息体
+	OnReply         func(s *SagaState, reply *BoxMessage) error // 处理成功的响应，可更新业务数据
+	CompensateTopic string                                      // 补偿命令主题，为空时该步骤无需补偿
+	Compensate      func(s *SagaState) (*BoxMessage, error)     // 构建补偿命令，为nil时以业务数据作为消息体
+	Timeout         time.Duration                               // 等待响应的超时时间，需要管理器配置延迟调度器，为0时不超时
+}
+
+// SagaDefinition 定义了一个按顺序执行步骤的Saga状态机，任一步骤失败、超时或进入死信时，按相反顺序补偿已完成的步骤。
+type SagaDefinition struct {
+	Name  string      // Saga定义名
+	Topic string      // 接收步骤响应与超时消息的主题，为空时为saga.{Name}
+	Steps []*SagaStep // 按顺序执行的步骤
+}
+
+// Saga 基于IManager的Publish与RegisterSubscriber实现的Saga编排器。
+type Saga struct {
+	def   *SagaDefinition
+	m     IManager
+	store SagaStore
+}
+
+// NewSaga 创建并返回一个新的Saga实例，需调用Register订阅响应与死信后再调用Start。
+func NewSaga(m IManager, store SagaStore, def *SagaDefinition) *Saga {
+	if def.Topic == "" {
+		def.Topic = "saga." + def.Name
+	}
+	return &Saga{def: def, m: m, store: store}
+}
+
+// Register 订阅Saga的响应主题，以及各步骤参与方对应的死信主题，多个实例共同消费。
+// 步骤设置了超时而WaterMillManager没有配置延迟调度器时返回ErrNoFoundScheduler，避免命令发出后才发现无法超时。
+func (s *Saga) Register(ctx context.Context) error {
+	if sm, ok := s.m.(interface{ Scheduler() *Scheduler }); ok && sm.Scheduler() == nil {
+		for _, step := range s.def.Steps {
+			if step.Timeout > 0 {
+				return ErrNoFoundScheduler
+			}
+		}
+	}
+	group := "saga." + s.def.Name
+	if err := s.m.RegisterSubscriber(ctx, s.def.Topic, WithGroup(group), WithHandle(s.handleReply)); err != nil {
+		return err
+	}
+	deads := map[string]bool{}
+	for _, step := range s.def.Steps {
+		stepGroup := step.Group
+		if stepGroup == "" {
+			stepGroup = step.Topic
+		}
+		topic := DeadTopic(step.Topic, stepGroup)
+		if deads[topic] {
+			continue
+		}
+		deads[topic] = true
+		if err := s.m.RegisterSubscriber(ctx, topic, WithGroup(group+".dead"), WithHandle(s.handleDead)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start 创建Saga实例并发送第一个步骤的命令，发送失败时实例标记为失败并返回错误。
+func (s *Saga) Start(ctx context.Context, id string, data []byte) (*SagaState, error) {
+	now := time.Now().UnixMilli()
+	state := &SagaState{Id: id, Name: s.def.Name, Status: SagaRunning, Data: data, CreatedAt: now, UpdatedAt: now}
+	if len(s.def.Steps) == 0 {
+		state.Status = SagaCompleted
+	}
+	if err := s.store.Create(ctx, state); err != nil {
+		return nil, err
+	}
+	if state.Status != SagaRunning {
+		return state, nil
+	}
+	if err := s.dispatch(ctx, state); err != nil {
+		state.Status, state.Error = SagaFailed, err.Error()
+		if uerr := s.store.Update(ctx, state); uerr != nil {
+			deflog.ErrorCtx(ctx, "保存Saga%s/%s失败%v", s.def.Name, id, uerr)
+		}
+		return state, err
+	}
+	return state, nil
+}
+
+// Get 获取Saga实例的状态。
+func (s *Saga) Get(ctx context.Context, id string) (*SagaState, error) {
+	return s.store.Get(ctx, s.def.Name, id)
+}
+
+// dispatch 发送当前步骤的命令，设置了超时时先发送延迟的超时消息，保证命令发出时超时已生效，命令发送失败时尽量取消超时消息。
+func (s *Saga) dispatch(ctx context.Context, state *SagaState) error {
+	step := s.def.Steps[state.Step]
+	box, err := sagaCommand(state, step.Command)
+	if err != nil {
+		return err
+	}
+	box.ReplyTo = s.def.Topic
+	box.Correlation = sagaCorrelation(state)
+	box.WithContext(ctx)
+	var timeout *BoxMessage
+	if step.Timeout > 0 {
+		timeout = NewBoxMessage().WithOption(WithEventType(SagaTimeoutEvent), WithKey(state.Id), WithDelay(step.Timeout))
+		timeout.SagaId = state.Id
+		timeout.Correlation = box.Correlation
+		if err := s.m.Publish(s.def.Topic, timeout); err != nil {
+			return err
+		}
+	}
+	if err := s.m.Publish(step.Topic, box); err != nil {
+		if scheduler := sagaScheduler(s.m); timeout != nil && scheduler != nil {
+			_ = scheduler.Cancel(ctx, timeout.MsgId) // 未取消的超时消息因步骤未推进而被忽略
+		}
+		return err
+	}
+	return nil
+}
+
+// handleReply 处理步骤的响应与超时消息，推进或补偿Saga实例，过期的响应直接忽略。
+func (s *Saga) handleReply(ctx context.Context, box *BoxMessage) error {
+	state, ok, err := s.running(ctx, box)
+	if !ok {
+		return err
+	}
+	if box.Correlation != "" && box.Correlation != sagaCorrelation(state) {
+		return nil // 之前步骤或已超时步骤的响应
+	}
+	if box.EventType == SagaTimeoutEvent {
+		return s.compensate(ctx, state, state.Step, fmt.Sprintf("步骤%s超时", s.def.Steps[state.Step].Name))
+	}
+	if box.ExecErr != "" {
+		return s.compensate(ctx, state, state.Step-1, box.ExecErr)
+	}
+	if step := s.def.Steps[state.Step]; step.OnReply != nil {
+		if err := step.OnReply(state, box); err != nil {
+			return s.compensate(ctx, state, state.Step-1, err.Error())
+		}
+	}
+	state.Step++
+	if state.Step == len(s.def.Steps) {
+		state.Status = SagaCompleted
+		return s.store.Update(ctx, state)
+	}
+	if err := s.dispatch(ctx, state); err != nil {
+		return err // 未保存步骤，重试时重新发送命令
+	}
+	return s.store.Update(ctx, state)
+}
+
+// handleDead 处理参与方死信主题中属于Saga当前步骤的命令，补偿已完成的步骤。
+func (s *Saga) handleDead(ctx context.Context, box *BoxMessage) error {
+	state, ok, err := s.running(ctx, box)
+	if !ok {
+		return err
+	}
+	if box.Topic != s.def.Steps[state.Step].Topic || (box.Correlation != "" && box.Correlation != sagaCorrelation(state)) {
+		return nil
+	}
+	return s.compensate(ctx, state, state.Step-1, box.ExecErr)
+}
+
+// running 返回消息所属的执行中的Saga实例，不属于该Saga或实例已结束时返回false。
+func (s *Saga) running(ctx context.Context, box *BoxMessage) (*SagaState, bool, error) {
+	if box.SagaId == "" {
+		return nil, false, nil
+	}
+	state, err := s.store.Get(ctx, s.def.Name, box.SagaId)
+	if errors.Is(err, ErrNoFoundSaga) {
+		return nil, false, nil // 其他Saga定义的实例
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return state, state.Status == SagaRunning, nil
+}
+
+// compensate 从序号from开始按相反顺序发送补偿命令，全部发送后标记为已补偿。发送失败时返回错误，重试时重新发送，补偿命令需幂等。
+func (s *Saga) compensate(ctx context.Context, state *SagaState, from int, reason string) error {
+	for i := from; i >= 0; i-- {
+		step := s.def.Steps[i]
+		if step.CompensateTopic == "" {
+			continue
+		}
+		box, err := sagaCommand(state, step.Compensate)
+		if err != nil {
+			return err
+		}
+		box.WithContext(ctx)
+		if err := s.m.Publish(step.CompensateTopic, box); err != nil {
+			return err
+		}
+	}
+	state.Status, state.Error = SagaCompensated, reason
+	return s.store.Update(ctx, state)
+}
+
+// sagaCommand 构建步骤或补偿命令，build为nil时以业务数据作为消息体，键默认为Saga实例ID。
+func sagaCommand(state *SagaState, build func(s *SagaState) (*BoxMessage, error)) (*BoxMessage, error) {
+	box := NewBoxMessage()
+	box.Value = state.Data
+	if build != nil {
+		var err error
+		if box, err = build(state); err != nil {
+			return nil, err
+		}
+	}
+	if box.Key == "" {
+		box.Key = state.Id // 同一实例的消息进入同一分区
+	}
+	box.SagaId = state.Id
+	return box, nil
+}
+
+// sagaScheduler 返回管理器配置的延迟调度器，管理器未提供调度器时为nil。
+func sagaScheduler(m IManager) *Scheduler {
+	if sm, ok := m.(interface{ Scheduler() *Scheduler }); ok {
+		return sm.Scheduler()
+	}
+	return nil
+}
+
+// sagaCorrelation 返回Saga实例当前步骤的关联ID，用于忽略过期的响应。
+func sagaCorrelation(state *SagaState) string {
+	return fmt.Sprintf("%s/%d", state.Id, state.Step)
+}
@@ -0,0 +1,94 @@
+package kafkaex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SQLSagaStore 基于database/sql的Saga状态存储，支持SQLite与Postgres，驱动由调用方引入。
+type SQLSagaStore struct {
+	db      *sql.DB
+	dialect string
+	table   string
+}
+
+// NewSQLSagaStore 创建并返回一个新的SQLSagaStore实例，table为空时使用kafkaex_saga。
+func NewSQLSagaStore(db *sql.DB, dialect, table string) *SQLSagaStore {
+	if table == "" {
+		table = "kafkaex_saga"
+	}
+	return &SQLSagaStore{db: db, dialect: dialect, table: table}
+}
+
+// Migrate 创建Saga状态表，表已存在时不做处理。
+func (s *SQLSagaStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	name VARCHAR(128) NOT NULL,
+	id VARCHAR(64) NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	step INTEGER NOT NULL,
+	data %s NOT NULL,
+	error TEXT NOT NULL,
+	version BIGINT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	PRIMARY KEY (name, id)
+)`, s.table, sqlBinaryType(s.dialect)))
+	return err
+}
+
+// Create 保存一个新的Saga实例，版本号从1开始。
+func (s *SQLSagaStore) Create(ctx context.Context, state *SagaState) error {
+	state.Version = 1
+	query := fmt.Sprintf("INSERT INTO %s (name, id, status, step, data, error, version, created_at, updated_at) VALUES (%s)",
+		s.table, sqlPlaceholders(s.dialect, 1, 9))
+	_, err := s.db.ExecContext(ctx, query, state.Name, state.Id, state.Status, state.Step, sqlBytes(state.Data), state.Error,
+		state.Version, state.CreatedAt, state.UpdatedAt)
+	return err
+}
+
+// Update 按版本号更新Saga实例并递增版本，版本不一致时返回ErrSagaConflict。
+func (s *SQLSagaStore) Update(ctx context.Context, state *SagaState) error {
+	query := fmt.Sprintf("UPDATE %s SET status = %s, step = %s, data = %s, error = %s, version = %s, updated_at = %s WHERE name = %s AND id = %s AND version = %s",
+		s.table, sqlPlaceholder(s.dialect, 1), sqlPlaceholder(s.dialect, 2), sqlPlaceholder(s.dialect, 3), sqlPlaceholder(s.dialect, 4),
+		sqlPlaceholder(s.dialect, 5), sqlPlaceholder(s.dialect, 6), sqlPlaceholder(s.dialect, 7), sqlPlaceholder(s.dialect, 8), sqlPlaceholder(s.dialect, 9))
+	updatedAt := time.Now().UnixMilli()
+	res, err := s.db.ExecContext(ctx, query, state.Status, state.Step, sqlBytes(state.Data), state.Error, state.Version+1, updatedAt,
+		state.Name, state.Id, state.Version)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return ErrSagaConflict
+	}
+	state.Version++
+	state.UpdatedAt = updatedAt
+	return nil
+}
+
+// Get 获取Saga实例，不存在时返回ErrNoFoundSaga。
+func (s *SQLSagaStore) Get(ctx context.Context, name, id string) (*SagaState, error) {
+	query := fmt.Sprintf("SELECT name, id, status, step, data, error, version, created_at, updated_at FROM %s WHERE name = %s AND id = %s",
+		s.table, sqlPlaceholder(s.dialect, 1), sqlPlaceholder(s.dialect, 2))
+	state := &SagaState{}
+	err := s.db.QueryRowContext(ctx, query, name, id).Scan(&state.Name, &state.Id, &state.Status, &state.Step, &state.Data, &state.Error,
+		&state.Version, &state.CreatedAt, &state.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoFoundSaga
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// sqlBytes 将nil转换为空切片，驱动将nil写入为NULL，不满足NOT NULL约束。
+func sqlBytes(v []byte) []byte {
+	if v == nil {
+		return []byte{}
+	}
+	return v
+}
@@ -0,0 +1,183 @@
+package kafkaex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSagaStore(t *testing.T) *SQLSagaStore {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	store := NewSQLSagaStore(db, DialectSQLite, "")
+	assert.Nil(t, store.Migrate(context.Background()))
+	return store
+}
+
+func TestSQLSagaStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSagaStore(t)
+	state := &SagaState{Id: "s1", Name: "order", Status: SagaRunning, Data: []byte(`{"id":"o1"}`)}
+	assert.Nil(t, store.Create(ctx, state))
+	got, err := store.Get(ctx, "order", "s1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), got.Version)
+	assert.Equal(t, `{"id":"o1"}`, string(got.Data))
+
+	got.Step = 1
+	assert.Nil(t, store.Update(ctx, got))
+	assert.Equal(t, int64(2), got.Version)
+	// 版本不一致时拒绝更新
+	assert.Equal(t, ErrSagaConflict, store.Update(ctx, state))
+	_, err = store.Get(ctx, "payment", "s1")
+	assert.Equal(t, ErrNoFoundSaga, err)
+
+	// 状态数据按二进制保存，nil写入为空值
+	got.Data = []byte{0xff, 0x00, 0xfe}
+	assert.Nil(t, store.Update(ctx, got))
+	got, err = store.Get(ctx, "order", "s1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xff, 0x00, 0xfe}, got.Data)
+	assert.Nil(t, store.Create(ctx, &SagaState{Id: "s2", Name: "order", Status: SagaRunning}))
+	got, err = store.Get(ctx, "order", "s2")
+	assert.Nil(t, err)
+	assert.Empty(t, got.Data)
+}
+
+// newOrderSaga 创建下单Saga：预留库存、扣款、发货，并注册库存与支付参与方。
+func newOrderSaga(t *testing.T, ctx context.Context, m IManager, payErr error, shipTimeout time.Duration) (*Saga, chan string) {
+	compensations := make(chan string, 10)
+	saga := NewSaga(m, newTestSagaStore(t), &SagaDefinition{
+		Name: "order",
+		Steps: []*SagaStep{
+			{Name: "reserve", Topic: "inventory.reserve", CompensateTopic: "inventory.release",
+				OnReply: func(s *SagaState, reply *BoxMessage) error {
+					s.Data = append(s.Data, reply.Value...)
+					return nil
+				}},
+			{Name: "pay", Topic: "payment.charge", CompensateTopic: "payment.refund"},
+			{Name: "ship", Topic: "shipping.ship", Timeout: shipTimeout},
+		},
+	})
+	assert.Nil(t, saga.Register(ctx))
+	wm := m.(*WaterMillManager)
+	assert.Nil(t, wm.RegisterResponder(ctx, "inventory.reserve", func(ctx context.Context, req *BoxMessage) (*BoxMessage, error) {
+		reply := NewBoxMessage()
+		reply.Value = []byte(",reserved")
+		return reply, nil
+	}))
+	assert.Nil(t, wm.RegisterResponder(ctx, "payment.charge", func(ctx context.Context, req *BoxMessage) (*BoxMessage, error) {
+		return nil, payErr
+	}))
+	for _, topic := range []string{"inventory.release", "payment.refund"} {
+		topic := topic
+		assert.Nil(t, m.RegisterSubscriber(ctx, topic, WithHandle(func(ctx context.Context, box *BoxMessage) error {
+			compensations <- topic + ":" + box.SagaId
+			return nil
+		})))
+	}
+	return saga, compensations
+}
+
+// waitSaga 等待Saga实例进入指定状态。
+func waitSaga(t *testing.T, saga *Saga, id, status string) *SagaState {
+	var state *SagaState
+	assert.Eventually(t, func() bool {
+		state, _ = saga.Get(context.Background(), id)
+		return state != nil && state.Status == status
+	}, 5*time.Second, 5*time.Millisecond)
+	return state
+}
+
+func TestSagaCompleted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	saga, compensations := newOrderSaga(t, ctx, m, nil, 0)
+	assert.Nil(t, m.(*WaterMillManager).RegisterResponder(ctx, "shipping.ship", func(ctx context.Context, req *BoxMessage) (*BoxMessage, error) {
+		return nil, nil
+	}))
+
+	_, err := saga.Start(ctx, "s1", []byte("o1"))
+	assert.Nil(t, err)
+	state := waitSaga(t, saga, "s1", SagaCompleted)
+	assert.Equal(t, 3, state.Step)
+	assert.Equal(t, "o1,reserved", string(state.Data))
+	assert.Len(t, compensations, 0)
+}
+
+func TestSagaCompensateOnReplyError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	saga, compensations := newOrderSaga(t, ctx, m, errors.New("card declined"), 0)
+
+	_, err := saga.Start(ctx, "s2", []byte("o2"))
+	assert.Nil(t, err)
+	state := waitSaga(t, saga, "s2", SagaCompensated)
+	assert.Equal(t, 1, state.Step)
+	assert.Equal(t, "card declined", state.Error)
+	// 仅补偿已完成的步骤
+	assert.Equal(t, "inventory.release:s2", <-compensations)
+	assert.Len(t, compensations, 0)
+}
+
+func TestSagaCompensateOnDeadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	saga, compensations := newOrderSaga(t, ctx, m, nil, 0)
+	// 发货方不响应，处理失败后进入死信
+	assert.Nil(t, m.RegisterSubscriber(ctx, "shipping.ship", WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		return errors.New("no carrier")
+	})))
+
+	_, err := saga.Start(ctx, "s3", []byte("o3"))
+	assert.Nil(t, err)
+	state := waitSaga(t, saga, "s3", SagaCompensated)
+	assert.Equal(t, 2, state.Step)
+	assert.Equal(t, "no carrier", state.Error)
+	assert.ElementsMatch(t, []string{"payment.refund:s3", "inventory.release:s3"}, []string{<-compensations, <-compensations})
+}
+
+func TestSagaTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scheduler := NewScheduler(newTestScheduleStore(t), WithScheduleInterval(10*time.Millisecond))
+	m := NewMemoryManager(WithScheduler(scheduler))
+	go func() { _ = scheduler.Run(ctx) }()
+	saga, compensations := newOrderSaga(t, ctx, m, nil, 50*time.Millisecond)
+
+	_, err := saga.Start(ctx, "s4", []byte("o4"))
+	assert.Nil(t, err)
+	state := waitSaga(t, saga, "s4", SagaCompensated)
+	assert.Equal(t, "步骤ship超时", state.Error)
+	assert.ElementsMatch(t, []string{"payment.refund:s4", "inventory.release:s4"}, []string{<-compensations, <-compensations})
+}
+
+func TestSagaTimeoutWithoutScheduler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	published := make(chan string, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, "shipping.ship", WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		published <- box.SagaId
+		return nil
+	})))
+	saga := NewSaga(m, newTestSagaStore(t), &SagaDefinition{
+		Name:  "order",
+		Steps: []*SagaStep{{Name: "ship", Topic: "shipping.ship", Timeout: time.Second}},
+	})
+	assert.Equal(t, ErrNoFoundScheduler, saga.Register(ctx))
+	// 超时消息发送失败时不发送命令
+	state, err := saga.Start(ctx, "s5", nil)
+	assert.Equal(t, ErrNoFoundScheduler, err)
+	assert.Equal(t, SagaFailed, state.Status)
+	assert.Never(t, func() bool { return len(published) > 0 }, 100*time.Millisecond, 10*time.Millisecond)
+}
@@ -0,0 +1,147 @@
+package kafkaex
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// ScheduledMessage 定义了一条等待投递的延迟消息。
+type ScheduledMessage struct {
+	Id        string      `json:"id" form:"id"`               // 延迟消息ID，即消息ID
+	Topic     string      `json:"topic" form:"topic"`         // 投递的主题
+	DeliverAt int64       `json:"deliverat" form:"deliverat"` // 投递时间戳(毫秒)
+	Box       *BoxMessage `json:"box" form:"box"`             // 完整的消息信封
+}
+
+// ScheduleStore 定义了延迟消息的持久化存储接口，内置SQL实现。
+type ScheduleStore interface {
+	// Save 保存一条延迟消息，ID已存在时覆盖。
+	Save(ctx context.Context, msg *ScheduledMessage) error
+	// Claim 领取至多limit条已到期的延迟消息，领取后lease时长内不会被再次领取，用于多实例部署时减少重复投递。
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*ScheduledMessage, error)
+	// Get 根据ID获取一条延迟消息，不存在时返回ErrNoFoundSchedule。
+	Get(ctx context.Context, id string) (*ScheduledMessage, error)
+	// Delete 根据ID删除延迟消息，返回删除的数量。
+	Delete(ctx context.Context, ids ...string) (int64, error)
+}
+
+// SchedulerOption 类型为函数，用于修改Scheduler实例
+type SchedulerOption func(*Scheduler)
+
+// WithScheduleInterval 设置轮询到期消息的间隔，默认1秒。
+func WithScheduleInterval(d time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.interval = d
+	}
+}
+
+// WithScheduleLease 设置领取到期消息后的租约时长，租约内未完成投递的消息会被再次领取，默认30秒。
+func WithScheduleLease(d time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.lease = d
+	}
+}
+
+// Scheduler 延迟消息调度器，将延迟消息持久化到存储，到期后发布到目标主题。
+// 先发布后删除，进程重启后继续投递，保证至少投递一次。
+type Scheduler struct {
+	store    ScheduleStore
+	manager  IManager
+	interval time.Duration
+	lease    time.Duration
+	batch    int
+}
+
+// NewScheduler 创建并返回一个新的Scheduler实例，通过WithScheduler配置到管理器后，
+// 设置了WithDeliverAt或WithDelay的消息发布时会交给调度器，需调用Run开始投递。
+func NewScheduler(store ScheduleStore, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		store:    store,
+		interval: time.Second,
+		lease:    30 * time.Second,
+		batch:    100,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithScheduler 为管理器配置延迟调度器，调度器使用该管理器投递到期的消息。
+func WithScheduler(s *Scheduler) ManagerOption {
+	return func(m *WaterMillManager) {
+		m.scheduler = s
+		s.manager = m
+	}
+}
+
+// Scheduler 返回管理器配置的延迟调度器，未配置时为nil。
+func (m *WaterMillManager) Scheduler() *Scheduler {
+	return m.scheduler
+}
+
+// Schedule 保存一条延迟消息，消息ID为空时生成，可用于Cancel。
+func (s *Scheduler) Schedule(ctx context.Context, topic string, box *BoxMessage) error {
+	if box.MsgId == "" {
+		box.MsgId = watermill.NewUUID()
+	}
+	return s.store.Save(ctx, &ScheduledMessage{
+		Id:        box.MsgId,
+		Topic:     topic,
+		DeliverAt: box.DeliverAt,
+		Box:       box,
+	})
+}
+
+// Cancel 在投递前取消延迟消息，已投递或不存在时返回ErrNoFoundSchedule。
+func (s *Scheduler) Cancel(ctx context.Context, id string) error {
+	count, err := s.store.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNoFoundSchedule
+	}
+	return nil
+}
+
+// Run 按间隔投递到期的延迟消息，直到上下文结束。
+func (s *Scheduler) Run(ctx context.Context) error {
+	if s.manager == nil {
+		return ErrNoFoundManager
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.Deliver(ctx); err != nil {
+			deflog.ErrorCtx(ctx, "投递延迟消息失败%v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deliver 投递一批到期的延迟消息，返回投递成功的数量。发布失败的消息在租约到期后重新投递。
+func (s *Scheduler) Deliver(ctx context.Context) (int, error) {
+	msgs, err := s.store.Claim(ctx, time.Now(), s.lease, s.batch)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, msg := range msgs {
+		if err := s.manager.Publish(msg.Topic, msg.Box); err != nil {
+			deflog.ErrorCtx(ctx, "投递延迟消息%s失败%v", msg.Id, err)
+			continue
+		}
+		if _, err := s.store.Delete(ctx, msg.Id); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
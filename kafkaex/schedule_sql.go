@@ -0,0 +1,138 @@
+package kafkaex
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SQLScheduleStore 基于database/sql的延迟消息存储，支持SQLite与Postgres，驱动由调用方引入。
+type SQLScheduleStore struct {
+	db      *sql.DB
+	dialect string
+	table   string
+}
+
+// NewSQLScheduleStore 创建并返回一个新的SQLScheduleStore实例，table为空时使用kafkaex_schedule。
+func NewSQLScheduleStore(db *sql.DB, dialect, table string) *SQLScheduleStore {
+	if table == "" {
+		table = "kafkaex_schedule"
+	}
+	return &SQLScheduleStore{db: db, dialect: dialect, table: table}
+}
+
+// Migrate 创建延迟消息表及索引，表已存在时不做处理。
+func (s *SQLScheduleStore) Migrate(ctx context.Context) error {
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(64) PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	deliver_at BIGINT NOT NULL,
+	lease_until BIGINT NOT NULL,
+	box TEXT NOT NULL
+)`, s.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_deliver ON %s (deliver_at)", s.table, s.table),
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save 保存一条延迟消息，ID已存在时覆盖并重置租约。
+func (s *SQLScheduleStore) Save(ctx context.Context, msg *ScheduledMessage) error {
+	bs, err := json.Marshal(msg.Box)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (id, topic, deliver_at, lease_until, box) VALUES (%s)
+ON CONFLICT (id) DO UPDATE SET topic = excluded.topic, deliver_at = excluded.deliver_at,
+lease_until = excluded.lease_until, box = excluded.box`,
+		s.table, sqlPlaceholders(s.dialect, 1, 5))
+	_, err = s.db.ExecContext(ctx, query, msg.Id, msg.Topic, msg.DeliverAt, 0, string(bs))
+	return err
+}
+
+// Claim 领取至多limit条已到期且不在租约内的延迟消息，按投递时间排序。
+func (s *SQLScheduleStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*ScheduledMessage, error) {
+	nowMs := now.UnixMilli()
+	query := fmt.Sprintf("SELECT id, topic, deliver_at, box FROM %s WHERE deliver_at <= %s AND lease_until <= %s ORDER BY deliver_at, id LIMIT %d",
+		s.table, sqlPlaceholder(s.dialect, 1), sqlPlaceholder(s.dialect, 2), limit)
+	rows, err := s.db.QueryContext(ctx, query, nowMs, nowMs)
+	if err != nil {
+		return nil, err
+	}
+	due := []*ScheduledMessage{}
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		due = append(due, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// 以条件更新租约抢占，其他实例已领取的消息跳过
+	update := fmt.Sprintf("UPDATE %s SET lease_until = %s WHERE id = %s AND lease_until <= %s",
+		s.table, sqlPlaceholder(s.dialect, 1), sqlPlaceholder(s.dialect, 2), sqlPlaceholder(s.dialect, 3))
+	res := make([]*ScheduledMessage, 0, len(due))
+	for _, msg := range due {
+		r, err := s.db.ExecContext(ctx, update, now.Add(lease).UnixMilli(), msg.Id, nowMs)
+		if err != nil {
+			return res, err
+		}
+		if n, _ := r.RowsAffected(); n == 1 {
+			res = append(res, msg)
+		}
+	}
+	return res, nil
+}
+
+// Get 根据ID获取一条延迟消息，不存在时返回ErrNoFoundSchedule。
+func (s *SQLScheduleStore) Get(ctx context.Context, id string) (*ScheduledMessage, error) {
+	query := fmt.Sprintf("SELECT id, topic, deliver_at, box FROM %s WHERE id = %s", s.table, sqlPlaceholder(s.dialect, 1))
+	msg, err := scanScheduledMessage(s.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoFoundSchedule
+	}
+	return msg, err
+}
+
+// Delete 根据ID删除延迟消息，返回删除的数量。
+func (s *SQLScheduleStore) Delete(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", s.table, sqlPlaceholders(s.dialect, 1, len(ids)))
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// scanScheduledMessage 从查询结果中读取一条延迟消息。
+func scanScheduledMessage(row interface{ Scan(...any) error }) (*ScheduledMessage, error) {
+	msg := &ScheduledMessage{}
+	var box string
+	if err := row.Scan(&msg.Id, &msg.Topic, &msg.DeliverAt, &box); err != nil {
+		return nil, err
+	}
+	msg.Box = &BoxMessage{}
+	if err := json.Unmarshal([]byte(box), msg.Box); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
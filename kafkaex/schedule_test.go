@@ -0,0 +1,101 @@
+package kafkaex
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestScheduleStore(t *testing.T) *SQLScheduleStore {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	store := NewSQLScheduleStore(db, DialectSQLite, "")
+	assert.Nil(t, store.Migrate(context.Background()))
+	return store
+}
+
+func TestSQLScheduleStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestScheduleStore(t)
+	now := time.Now()
+	for i, id := range []string{"a", "b", "c"} {
+		box := NewBoxMessage()
+		box.MsgId = id
+		assert.Nil(t, store.Save(ctx, &ScheduledMessage{Id: id, Topic: "orders", DeliverAt: now.Add(time.Duration(i-1) * time.Minute).UnixMilli(), Box: box}))
+	}
+
+	// 仅领取到期的消息，租约内不会被再次领取
+	msgs, err := store.Claim(ctx, now, time.Minute, 10)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "a", msgs[0].Id)
+	assert.Equal(t, "orders", msgs[0].Topic)
+	msgs, err = store.Claim(ctx, now, time.Minute, 10)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 0)
+	// 租约到期后重新领取
+	msgs, err = store.Claim(ctx, now.Add(2*time.Minute), time.Minute, 10)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 3)
+
+	msg, err := store.Get(ctx, "c")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", msg.Box.MsgId)
+	count, err := store.Delete(ctx, "a", "b", "c")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+	_, err = store.Get(ctx, "c")
+	assert.Equal(t, ErrNoFoundSchedule, err)
+}
+
+func TestSchedulerDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := newTestScheduleStore(t)
+	scheduler := NewScheduler(store, WithScheduleInterval(10*time.Millisecond))
+	m := NewMemoryManager(WithScheduler(scheduler))
+	got := make(chan *BoxMessage, 2)
+	assert.Nil(t, m.RegisterSubscriber(ctx, "reminders", WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		got <- box
+		return nil
+	})))
+
+	delayed := NewBoxMessage().WithOption(WithDelay(50 * time.Millisecond))
+	delayed.Value = []byte("later")
+	assert.Nil(t, m.Publish("reminders", delayed))
+	assert.NotEmpty(t, delayed.MsgId)
+	canceled := NewBoxMessage().WithOption(WithDeliverAt(time.Now().Add(50 * time.Millisecond)))
+	canceled.MsgId = "cancel-me"
+	assert.Nil(t, m.Publish("reminders", canceled))
+	assert.Nil(t, scheduler.Cancel(ctx, "cancel-me"))
+	assert.Equal(t, ErrNoFoundSchedule, scheduler.Cancel(ctx, "cancel-me"))
+
+	go func() { _ = scheduler.Run(ctx) }()
+	select {
+	case box := <-got:
+		assert.GreaterOrEqual(t, time.Now().UnixMilli(), delayed.DeliverAt)
+		assert.Equal(t, "later", string(box.Value))
+		assert.Equal(t, delayed.DeliverAt, box.DeliverAt)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for delayed message")
+	}
+	select {
+	case <-got:
+		t.Fatal("canceled message should not be delivered")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// 投递后从存储中删除
+	_, err := store.Get(ctx, delayed.MsgId)
+	assert.Equal(t, ErrNoFoundSchedule, err)
+}
+
+func TestPublishDelayWithoutScheduler(t *testing.T) {
+	m := NewMemoryManager()
+	box := NewBoxMessage().WithOption(WithDelay(time.Minute))
+	assert.Equal(t, ErrNoFoundScheduler, m.Publish("orders", box))
+}
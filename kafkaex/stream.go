@@ -0,0 +1,172 @@
+package kafkaex
+
+import (
+	"context"
+	"sync"
+)
+
+// streamSource 流的源主题，由根节点订阅。
+type streamSource struct {
+	m     IManager
+	topic string
+	opts  []Option
+	root  *Stream
+	once  sync.Once
+	err   error
+}
+
+// streamBranch 流的分支，消息进入第一个匹配的分支。
+type streamBranch struct {
+	pred  func(box *BoxMessage) bool
+	child *Stream
+}
+
+// Stream 基于RegisterSubscriber与Publish的轻量流处理，按顺序执行Filter与Map，随后发布到To的主题并进入匹配的分支。
+// 任一阶段失败时源消息按订阅配置进入重试与死信，重试时从头执行，已发布的输出可能重复。
+type Stream struct {
+	source   *streamSource
+	ops      []func(ctx context.Context, box *BoxMessage) (*BoxMessage, error)
+	sinks    []string
+	branches []*streamBranch
+}
+
+// NewStream 创建并返回订阅topic的流，opts为订阅配置，如WithGroup、WithRetryMax，需调用Start开始处理。
+func NewStream(m IManager, topic string, opts ...Option) *Stream {
+	s := &Stream{}
+	s.source = &streamSource{m: m, topic: topic, opts: opts, root: s}
+	return s
+}
+
+// Stream 创建并返回订阅topic的流。
+func (m *WaterMillManager) Stream(topic string, opts ...Option) *Stream {
+	return NewStream(m, topic, opts...)
+}
+
+// Filter 仅保留f返回true的消息。
+func (s *Stream) Filter(f func(box *BoxMessage) bool) *Stream {
+	s.ops = append(s.ops, func(ctx context.Context, box *BoxMessage) (*BoxMessage, error) {
+		if !f(box) {
+			return nil, nil
+		}
+		return box, nil
+	})
+	return s
+}
+
+// Map 转换消息，返回nil时丢弃，返回错误时源消息进入重试。返回的新消息中未设置的键、跟踪ID、事件类型与自定义消息头沿用输入的消息。
+// 流处理的是源消息的副本，任一阶段失败时以未转换的源消息重试。
+func (s *Stream) Map(f func(ctx context.Context, box *BoxMessage) (*BoxMessage, error)) *Stream {
+	s.ops = append(s.ops, func(ctx context.Context, box *BoxMessage) (*BoxMessage, error) {
+		out, err := f(ctx, box)
+		if err != nil || out == nil || out == box {
+			return out, err
+		}
+		if out.Key == "" {
+			out.Key = box.Key
+		}
+		if out.TraceId == "" {
+			out.TraceId = box.TraceId
+		}
+		if out.EventType == "" {
+			out.EventType = box.EventType
+		}
+		for k, v := range box.Headers {
+			if _, ok := out.Headers[k]; !ok {
+				if out.Headers == nil {
+					out.Headers = map[string]string{}
+				}
+				out.Headers[k] = v
+			}
+		}
+		return out, nil
+	})
+	return s
+}
+
+// Branch 按preds拆分为多个分支，消息进入第一个匹配的分支，均不匹配时丢弃。
+func (s *Stream) Branch(preds ...func(box *BoxMessage) bool) []*Stream {
+	res := make([]*Stream, 0, len(preds))
+	for _, pred := range preds {
+		child := &Stream{source: s.source}
+		s.branches = append(s.branches, &streamBranch{pred: pred, child: child})
+		res = append(res, child)
+	}
+	return res
+}
+
+// To 将消息发布到topic，保留键、跟踪、事件类型、自定义消息头与透传的上下文，可多次调用发布到多个主题。
+func (s *Stream) To(topic string) *Stream {
+	s.sinks = append(s.sinks, topic)
+	return s
+}
+
+// Start 订阅源主题并开始处理，在任一节点上调用均启动整个流，仅首次调用生效。
+func (s *Stream) Start(ctx context.Context) error {
+	src := s.source
+	src.once.Do(func() {
+		src.err = src.m.RegisterSubscriber(ctx, src.topic, append(src.opts, WithHandle(src.root.handle))...)
+	})
+	return src.err
+}
+
+// handle 以源消息的副本执行流，阶段对消息的修改不影响进入重试与死信的源消息。
+func (s *Stream) handle(ctx context.Context, box *BoxMessage) error {
+	return s.process(ctx, streamClone(box))
+}
+
+// process 依次执行节点的阶段，发布到输出主题并交给匹配的分支。
+func (s *Stream) process(ctx context.Context, box *BoxMessage) error {
+	var err error
+	for _, op := range s.ops {
+		if box, err = op(ctx, box); err != nil || box == nil {
+			return err
+		}
+	}
+	for _, topic := range s.sinks {
+		if err := s.source.m.Publish(topic, streamForward(ctx, box)); err != nil {
+			return err
+		}
+	}
+	for _, b := range s.branches {
+		if b.pred(box) {
+			return b.child.process(ctx, box)
+		}
+	}
+	return nil
+}
+
+// streamClone 复制消息，消息头与消息值不与源消息共用。
+func streamClone(box *BoxMessage) *BoxMessage {
+	out := *box
+	out.Value = append([]byte(nil), box.Value...)
+	out.Headers = cloneStrings(box.Headers)
+	out.Metas = cloneStrings(box.Metas)
+	out.Propagation = cloneStrings(box.Propagation)
+	return &out
+}
+
+// cloneStrings 复制字符串映射，nil时返回nil。
+func cloneStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+// streamForward 由处理中的消息构建发布到下游的信封，不沿用源主题、组别与重试等消费状态，链路以本次消费为父级。
+func streamForward(ctx context.Context, box *BoxMessage) *BoxMessage {
+	out := NewBoxMessage().WithOption(WithKey(box.Key), WithTraceID(box.TraceId), WithEventType(box.EventType))
+	out.Value = box.Value
+	out.ExpireAt = box.ExpireAt
+	if len(box.Headers) > 0 {
+		out.Headers = make(map[string]string, len(box.Headers))
+		for k, v := range box.Headers {
+			out.Headers[k] = v
+		}
+	}
+	return out.WithContext(ctx)
+}
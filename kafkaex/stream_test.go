@@ -0,0 +1,106 @@
+package kafkaex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	got := make(chan *BoxMessage, 10)
+	for _, topic := range []string{"orders.big", "orders.small", "orders.all"} {
+		assert.Nil(t, m.RegisterSubscriber(ctx, topic, WithHandle(func(ctx context.Context, box *BoxMessage) error {
+			got <- box
+			return nil
+		})))
+	}
+
+	branches := m.Stream("orders", WithGroup("pipeline")).
+		Filter(func(box *BoxMessage) bool { return box.EventType == "created" }).
+		Map(func(ctx context.Context, box *BoxMessage) (*BoxMessage, error) {
+			box.Value = bytes.ToUpper(box.Value)
+			return box, nil
+		}).
+		To("orders.all").
+		Branch(
+			func(box *BoxMessage) bool { return len(box.Value) > 3 },
+			func(box *BoxMessage) bool { return true },
+		)
+	branches[0].Map(func(ctx context.Context, box *BoxMessage) (*BoxMessage, error) {
+		out := NewBoxMessage()
+		out.Value = []byte(strconv.Itoa(len(box.Value)))
+		return out, nil
+	}).To("orders.big")
+	branches[1].To("orders.small")
+	assert.Nil(t, branches[1].Start(ctx))
+	assert.Nil(t, branches[0].Start(ctx)) // 重复启动不再订阅
+
+	for _, v := range []string{"abcd", "ab"} {
+		box := NewBoxMessage().WithOption(WithEventType("created"), WithKey("k-"+v), WithTraceID("t-"+v))
+		box.Value = []byte(v)
+		assert.Nil(t, box.SetHeader("tenant", "a"))
+		assert.Nil(t, m.Publish("orders", box))
+	}
+	ignored := NewBoxMessage().WithOption(WithEventType("deleted"))
+	assert.Nil(t, m.Publish("orders", ignored))
+
+	res := map[string]*BoxMessage{}
+	for i := 0; i < 4; i++ {
+		box := <-got
+		res[box.Topic+":"+string(box.Value)] = box
+	}
+	assert.Len(t, got, 0)
+	assert.Contains(t, res, "orders.all:ABCD")
+	assert.Contains(t, res, "orders.all:AB")
+	assert.Contains(t, res, "orders.small:AB")
+	// 新消息沿用输入的键、跟踪ID、事件类型与自定义消息头
+	big := res["orders.big:4"]
+	if assert.NotNil(t, big) {
+		assert.Equal(t, "k-abcd", big.Key)
+		assert.Equal(t, "t-abcd", big.TraceId)
+		assert.Equal(t, "created", big.EventType)
+		assert.Equal(t, "a", big.GetHeader("tenant"))
+	}
+	assert.Len(t, m.Subscriptions(), 4)
+}
+
+func TestStreamStageError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager()
+	retries := make(chan *BoxMessage, 10)
+	assert.Nil(t, m.RegisterSubscriber(ctx, APHMQITP_RETRY, WithGroup(APHMQIGP_INNER), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		retries <- box
+		return nil
+	})))
+	assert.Nil(t, NewStream(m, "payments", WithGroup("enrich")).
+		Map(func(ctx context.Context, box *BoxMessage) (*BoxMessage, error) {
+			box.Value = append(box.Value, "-mapped"...)
+			_ = box.SetHeader("stage", "map")
+			return box, nil
+		}).
+		Map(func(ctx context.Context, box *BoxMessage) (*BoxMessage, error) {
+			return nil, errors.New("lookup failed")
+		}).
+		To("payments.enriched").
+		Start(ctx))
+
+	box := NewBoxMessage().WithOption(WithRetryMax(3))
+	box.Value = []byte("p1")
+	assert.Nil(t, m.Publish("payments", box))
+	// 阶段失败时源消息进入重试队列
+	retried := <-retries
+	assert.Equal(t, "payments", retried.Topic)
+	assert.Equal(t, "enrich", retried.ExecGroup)
+	assert.Equal(t, "lookup failed", retried.ExecErr)
+	// 重试的是未转换的源消息
+	assert.Equal(t, "p1", string(retried.Value))
+	assert.Equal(t, "", retried.GetHeader("stage"))
+}
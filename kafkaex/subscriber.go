@@ -11,20 +11,29 @@ import (
 )
 
 // RegisterRetry 注册一个重试消息的订阅者。如果提供的处理程序为nil，则使用默认的重试发布处理程序。
+// 始终订阅共享的内置重试主题，设置了命名模板时同时订阅各订阅对应的重试主题。
 // ctx: 上下文，用于控制函数的生命周期。
 // h: 自定义的消息处理程序，如果为nil，则使用默认处理程序。
 // 返回值: 执行过程中遇到的任何错误。
 func (m *WaterMillManager) RegisterRetry(ctx context.Context, h Handler) error {
 	if h == nil {
-		h = defaultRetryPublishHandle
+		h = newRetryPublishHandle(m)
 	}
-	return m.RegisterSubscriber(ctx, APHMQITP_RETRY,
+	if _, err := m.subscribe(ctx, APHMQITP_RETRY,
 		WithGroup(APHMQIGP_INNER),
 		WithTopic(APHMQITP_RETRY),
-		WithHandle(h))
+		WithHandle(h)); err != nil {
+		return err
+	}
+	m.innerMu.Lock()
+	m.retryHandle = h
+	origins := append([]innerOrigin{}, m.innerOrigins...)
+	m.innerMu.Unlock()
+	return m.registerInner(ctx, origins...) // 为已注册的订阅补充按模板命名的重试消费
 }
 
-// RegisterDead 注册一个死信消息的订阅者。如果提供的处理程序为nil，则使用默认的死信处理程序。
+// RegisterDead 注册一个死信消息的订阅者。如果提供的处理程序为nil，则使用默认的死信处理程序。设置了死信通知器时，每条死信都会触发通知。
+// 始终订阅共享的内置死信主题，设置了命名模板时同时订阅各订阅对应的死信主题。
 // ctx: 上下文，用于控制函数的生命周期。
 // h: 自定义的消息处理程序，如果为nil，则使用默认处理程序。
 // 返回值: 执行过程中遇到的任何错误。
@@ -32,42 +41,69 @@ func (m *WaterMillManager) RegisterDead(ctx context.Context, h Handler) error {
 	if h == nil {
 		h = defaultDeadHandle
 	}
-	return m.RegisterSubscriber(ctx, APHMQITP_DEAD,
+	h = withDeadNotify(h) // 设置了死信通知器时触发通知
+	if _, err := m.subscribe(ctx, APHMQITP_DEAD,
 		WithGroup(APHMQIGP_INNER),
 		WithTopic(APHMQITP_DEAD),
-		WithHandle(h))
+		WithHandle(h)); err != nil {
+		return err
+	}
+	m.innerMu.Lock()
+	m.deadHandle = h
+	origins := append([]innerOrigin{}, m.innerOrigins...)
+	m.innerMu.Unlock()
+	return m.registerInner(ctx, origins...) // 为已注册的订阅补充按模板命名的死信消费
 }
 
-// RegisterSubscriber 注册一个自定义主题的订阅者。
+// RegisterSubscriber 注册一个自定义主题的订阅者。设置了命名模板时，自动注册该订阅对应的重试与死信消费。
 // ctx: 上下文，用于控制函数的生命周期。
 // topic: 要订阅的主题。
 // opts: 一系列选项，用于配置订阅者。
 // 返回值: 执行过程中遇到的任何错误。
 func (m *WaterMillManager) RegisterSubscriber(ctx context.Context, topic string, opts ...Option) error {
+	opt, err := m.subscribe(ctx, topic, opts...)
+	if err != nil {
+		return err
+	}
+	return m.registerInner(ctx, innerOrigin{topic: topic, group: opt.Group})
+}
+
+// subscribe 订阅主题并启动消息处理协程，返回生效的订阅配置。
+func (m *WaterMillManager) subscribe(ctx context.Context, topic string, opts ...Option) (*Options, error) {
 	opt := NewOptions(opts...)
+	if opt.Topic == "" {
+		opt.Topic = topic // 未配置主题时使用订阅的主题
+	}
 	if err := opt.Fmt().Verify(); err != nil {
-		return err
+		return nil, err
 	}
 	if opt.Handle == nil {
-		return ErrNoFoundHandle
+		return nil, ErrNoFoundHandle
 	}
-	sub := m.Subs.GetOrSet(opt.Group, func(key string) (*kafka.Subscriber, error) {
-		return NewSubscriber(key, opt.Overwrite)
+	sub := m.subs.GetOrSet(opt.Group, func(key string) (*message.Subscriber, error) {
+		s, err := m.newSubscriber(key, opt.Overwrite)
+		if ks, ok := s.(*kafka.Subscriber); ok && ks != nil {
+			m.Subs.SetItem(key, ks)
+		}
+		return &s, err
 	})
 	if sub == nil {
-		return ErrNoFoundSubscriber
+		return nil, ErrNoFoundSubscriber
 	}
-	messageCh, err := sub.Subscribe(ctx, topic)
+	messageCh, err := (*sub).Subscribe(ctx, topic)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	execer := fmt.Sprintf("%s,%s", getName(), opt.Group)
-	process, err := processHanlder(topic, execer, opt.Handle)
+	process, err := processHanlder(m, topic, execer, opt)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	go process(ctx, messageCh)
-	return nil
+	status := m.track(topic, opt.Group, opt.Breaker)
+	go func() {
+		m.untrack(status, process(ctx, messageCh))
+	}()
+	return opt, nil
 }
 
 // NewSubscriber 创建并返回一个新的Kafka订阅者实例。
@@ -98,35 +134,128 @@ func NewSubscriber(group string, ow func(*sarama.Config) *sarama.Config) (*kafka
 }
 
 // processHandler 创建并返回一个处理消息的函数。
+// m: 用于发布重试与死信消息的管理器。
 // topic: 订阅的主题。
 // executer: 执行者的标识。
-// handle: 消息处理程序。
-// 返回值: 一个函数，该函数可被Go协程调用以处理消息。
-func processHanlder(topic, executer string, handle Handler) (func(ctx context.Context, messages <-chan *message.Message), error) {
-	m := GetManager()
+// opt: 订阅的配置，包括组别与消息处理程序。
+// 返回值: 一个函数，该函数可被Go协程调用以处理消息，阻塞策略下消费失败时返回错误，消息通道关闭时返回nil。
+func processHanlder(m IManager, topic, executer string, opt *Options) (func(ctx context.Context, messages <-chan *message.Message) error, error) {
 	if m == nil {
 		return nil, ErrNoFoundManager
 	}
-	return func(ctx context.Context, messages <-chan *message.Message) {
+	group, handle, breaker, limiter := opt.Group, opt.Handle, opt.Breaker, opt.Limiter
+	flow := flowOf(m, topic, group)
+	return func(ctx context.Context, messages <-chan *message.Message) error {
 		for msg := range messages {
-			box := NewBoxMessage()
-			box.WithRawMessage(msg)
-			err := invoke(ctx, box, handle) // 执行订阅
+			if flow != nil {
+				if err := flow.wait(ctx); err != nil {
+					return nil // 暂停或限流期间上下文结束，未确认的消息由订阅者重新投递
+				}
+			}
+			box := consumeBox(topic, opt, msg)
+			if skipConsume(ctx, topic, opt, box) {
+				msg.Ack()
+				continue
+			}
+			if limiter != nil {
+				if err := limiter.Wait(ctx, box); err != nil {
+					return nil
+				}
+			}
+			if breaker != nil && breaker.State() == BreakerOpen {
+				// 上一条消息探测失败达到上限后仍处于熔断，冷却后以本条消息探测
+				if werr := breaker.wait(ctx); werr != nil {
+					return nil
+				}
+			}
+			release, err := acquireOf(ctx, m) // 管理器的并发上限
+			if err != nil {
+				return nil
+			}
+			spanCtx, span := startConsumeSpan(ctx, topic, group, box)
+			done := getMetrics().HandleStart(topic, group, box.PublishAt)
+			err = invoke(spanCtx, box, handle) // 执行订阅
+			done(err)
+			release()
+			expired, probes := false, 0
+			for breaker != nil && breaker.hold(err) {
+				if breaker.exhausted(probes) {
+					deflog.ErrorCtx(ctx, "订阅%s/%s熔断，消息探测%d次失败，转入错误处理%v", topic, group, probes, err)
+					break // 保持熔断，该消息进入重试与死信
+				}
+				// 熔断期间消息保留在源主题，冷却后以该消息探测
+				deflog.ErrorCtx(ctx, "订阅%s/%s熔断，暂停消费%v", topic, group, err)
+				endSpan(span, err)
+				if werr := breaker.wait(ctx); werr != nil {
+					return nil
+				}
+				if expired = box.Expired() && !isDeadTopic(topic, box); expired {
+					break // 熔断期间过期，由下一条消息探测
+				}
+				if release, err = acquireOf(ctx, m); err != nil {
+					return nil
+				}
+				spanCtx, span = startConsumeSpan(ctx, topic, group, box)
+				done = getMetrics().HandleStart(topic, group, box.PublishAt)
+				err = invoke(spanCtx, box, handle)
+				done(err)
+				release()
+				probes++
+			}
+			if expired {
+				handleExpired(ctx, topic, group, box, opt.OnExpired)
+				msg.Ack()
+				continue
+			}
 			if err != nil {
 				if box.Blocked() {
 					deflog.ErrorCtx(ctx, "消费使用阻塞策略,无法进入重试以及死信队列%v", err)
-					return
+					endSpan(span, err)
+					return err
 				}
+				box.WithContext(spanCtx) // 重试与死信链路以本次消费为父级
 				if subErr := ErrExec(topic, executer, box, err, m.Publish); subErr != nil {
 					deflog.ErrorCtx(ctx, "发送错误消息至处理队列失败%v", subErr)
 				}
 			}
+			endSpan(span, err)
 			msg.Ack()
 		}
+		return nil
 	}, nil
 }
 
+// consumeBox 由消费的消息构建信封，记录源主题与消费的组别。
+func consumeBox(topic string, opt *Options, msg *message.Message) *BoxMessage {
+	box := NewBoxMessage()
+	box.WithRawMessage(msg)
+	if opt.Interop && IsForeign(msg.Metadata) {
+		box.withInterop(topic, opt) // 外部消息以订阅配置补全信封
+	}
+	if !isInnerTopic(topic, box) {
+		if box.Topic == "" {
+			box.Topic = topic // 记录源主题，用于重试与死信重放
+		}
+		box.ExecGroup = opt.Group // 记录消费的组别，用于命名重试与死信主题
+	}
+	return box
+}
+
+// skipConsume 判断消息是否跳过处理，被过滤与已过期的消息直接确认，不计为失败。
+func skipConsume(ctx context.Context, topic string, opt *Options, box *BoxMessage) bool {
+	if opt.Filter != nil && !opt.Filter(box) {
+		getMetrics().ObserveFiltered(topic, opt.Group) // 不关注的消息确认后跳过
+		return true
+	}
+	if box.Expired() && !isDeadTopic(topic, box) {
+		handleExpired(ctx, topic, opt.Group, box, opt.OnExpired) // 过期消息不再处理，死信保留用于排查
+		return true
+	}
+	return false
+}
+
 // ErrExec 处理错误执行逻辑，并根据错误情况发布到不同的主题。
+// 重试与死信主题由源主题与消费失败的组别(ExecGroup，为空时取Group)按命名模板生成，未设置模板时为共享的内置主题。
 //
 // 参数:
 // topic - 消息的主题。
@@ -139,15 +268,26 @@ func processHanlder(topic, executer string, handle Handler) (func(ctx context.Co
 // 返回调用publishFunc函数时的错误，如果publishFunc执行失败。
 func ErrExec(topic, executer string, box *BoxMessage, err error, publishFunc func(string, *BoxMessage) error) error {
 	// 判断是否为内部错误主题
-	isInner := topic == APHMQITP_DEAD || topic == APHMQITP_RETRY
+	isInner := isInnerTopic(topic, box)
 	if !isInner {
+		if box.Topic == "" {
+			box.Topic = topic // 记录源主题，用于重试与死信重放
+		}
+		if box.ExecGroup == "" {
+			box.ExecGroup = box.Group
+		}
 		box.ExecResult(executer, err) // 处理非内部错误的结果，并将结果封装到消息中
 	}
 	// 根据是否为内部错误或消息盒标记为死亡状态，决定发布到哪个主题
-	if isInner || box.Dead() {
-		return publishFunc(APHMQITP_DEAD, box)
+	if isInner {
+		getMetrics().ObserveDead(box.Topic)
+		return publishFunc(DeadTopic(box.Topic, box.ExecGroup), box)
+	} else if box.Dead() {
+		getMetrics().ObserveDead(topic)
+		return publishFunc(DeadTopic(box.Topic, box.ExecGroup), box)
 	} else {
-		return publishFunc(APHMQITP_RETRY, box)
+		getMetrics().ObserveRetry(topic)
+		return publishFunc(RetryTopic(box.Topic, box.ExecGroup), box)
 	}
 }
 
@@ -167,6 +307,8 @@ func invoke(ctx context.Context, box *BoxMessage, handle Handler) (err error) {
 	if box.TraceId != "" {
 		ctx = core.TraceID.SetString(ctx, box.TraceId)
 	}
+	// metas
+	ctx = restoreMetas(ctx, box.Metas)
 	// timeout
 	if box.HandleTimeout != 0 {
 		ctx, cancel = context.WithTimeout(ctx, box.HandleTimeout)
@@ -0,0 +1,244 @@
+package kafkaex
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-kafka/v3/pkg/kafka"
+)
+
+// TableStore 定义了Table的键值存储接口，内置内存与SQL实现。
+type TableStore interface {
+	// Reset 清空存储，Table启动时调用，随后从头读取主题重建。
+	Reset(ctx context.Context) error
+	// Put 写入键值。
+	Put(ctx context.Context, key string, value []byte) error
+	// Delete 删除键。
+	Delete(ctx context.Context, key string) error
+	// Get 读取键值，不存在时返回false。
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Range 按键的顺序遍历键值，fn返回false时停止。
+	Range(ctx context.Context, fn func(key string, value []byte) bool) error
+}
+
+// TableChange 定义了Table中一个键的变更。
+type TableChange struct {
+	Key     string // 消息键
+	Value   []byte // 新值，删除时为nil
+	Old     []byte // 旧值，新增时为nil
+	Deleted bool   // 是否为删除(墓碑消息)
+}
+
+// TableOption 类型为函数，用于修改Table实例
+type TableOption func(*Table)
+
+// WithTableStore 设置Table的键值存储，默认使用内存存储。
+func WithTableStore(s TableStore) TableOption {
+	return func(t *Table) {
+		t.store = s
+	}
+}
+
+// Table 由压缩主题物化的键值视图，从头读取主题，以消息键(APHMQH_PARTITION_KEY，外部消息为Kafka消息键)为键保存最新的消息体，消息体为空的墓碑消息删除该键。
+// 每个实例使用独立的消费组且不提交偏移量，每次启动都从头重建。写入存储失败时停止读取，避免视图缺失更新，错误由Err与WaitUntilCaughtUp返回。
+type Table struct {
+	m         *WaterMillManager
+	topic     string
+	store     TableStore
+	mu        sync.RWMutex
+	onChange  []func(ctx context.Context, change *TableChange)
+	watermark map[int32]int64
+	progress  map[int32]int64
+	caughtUp  chan struct{}
+	caughtOne sync.Once
+	err       error
+	failed    chan struct{}
+	started   bool
+}
+
+// NewTable 创建并返回主题的Table实例，需调用Start开始读取。
+func (m *WaterMillManager) NewTable(topic string, opts ...TableOption) *Table {
+	t := &Table{
+		m:        m,
+		topic:    topic,
+		store:    NewMemoryTableStore(),
+		progress: map[int32]int64{},
+		caughtUp: make(chan struct{}),
+		failed:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// OnChange 注册键变更的回调，在Start之前注册可收到初始读取时的变更。回调在读取协程中依次执行，不应阻塞。
+func (t *Table) OnChange(fn func(ctx context.Context, change *TableChange)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onChange = append(t.onChange, fn)
+}
+
+// Start 清空存储，记录主题当前的最新偏移量，并从头开始读取主题，直到ctx结束。每个实例只能成功启动一次，重复调用返回ErrTableStarted。
+func (t *Table) Start(ctx context.Context) (err error) {
+	t.mu.Lock()
+	if t.started {
+		t.mu.Unlock()
+		return ErrTableStarted
+	}
+	t.started = true
+	t.mu.Unlock()
+	defer func() {
+		if err != nil {
+			t.mu.Lock()
+			t.started = false // 启动失败时允许重试
+			t.mu.Unlock()
+		}
+	}()
+	if err := t.store.Reset(ctx); err != nil {
+		return err
+	}
+	watermark, err := t.m.watermarks(ctx, t.topic)
+	if err != nil {
+		return err
+	}
+	t.watermark = watermark
+	group := fmt.Sprintf("%s.table.%s.%s", getName(), t.topic, watermill.NewShortUUID())
+	sub, err := t.m.newSubscriber(group, func(cfg *sarama.Config) *sarama.Config {
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+		cfg.Consumer.Offsets.AutoCommit.Enable = false // 独立的消费组，无需提交偏移量
+		return cfg
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	messages, err := sub.Subscribe(ctx, t.topic)
+	if err != nil {
+		cancel()
+		_ = sub.Close()
+		return err
+	}
+	t.checkCaughtUp()
+	status := t.m.track(t.topic, group, nil)
+	go func() {
+		defer sub.Close() // 读取结束后关闭本次创建的订阅者
+		defer cancel()
+		for msg := range messages {
+			box := NewBoxMessage()
+			box.WithRawMessage(msg)
+			if box.Key == "" {
+				if key, ok := kafka.MessageKeyFromCtx(msg.Context()); ok {
+					box.Key = string(key)
+				}
+			}
+			if err := t.apply(ctx, box); err != nil {
+				deflog.ErrorCtx(ctx, "更新Table%s的键%s失败，停止读取%v", t.topic, box.Key, err)
+				msg.Nack()
+				t.fail(err)
+				t.m.untrack(status, err)
+				return
+			}
+			msg.Ack()
+			t.mu.Lock()
+			if partition, ok := kafka.MessagePartitionFromCtx(msg.Context()); ok {
+				offset, _ := kafka.MessagePartitionOffsetFromCtx(msg.Context())
+				t.progress[partition] = offset + 1
+			} else {
+				t.progress[0]++ // 内存队列视为单个分区
+			}
+			t.mu.Unlock()
+			t.checkCaughtUp()
+		}
+		t.m.untrack(status, nil)
+	}()
+	return nil
+}
+
+// fail 记录写入存储的错误并通知等待中的WaitUntilCaughtUp。
+func (t *Table) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+	close(t.failed)
+}
+
+// Err 返回导致Table停止读取的错误，正常读取时为nil。
+func (t *Table) Err() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.err
+}
+
+// apply 将消息写入存储并触发变更回调。
+func (t *Table) apply(ctx context.Context, box *BoxMessage) error {
+	if box.Key == "" {
+		return nil // 没有键的消息无法物化
+	}
+	old, existed, err := t.store.Get(ctx, box.Key)
+	if err != nil {
+		return err
+	}
+	change := &TableChange{Key: box.Key, Old: old}
+	if len(box.Value) == 0 {
+		if !existed {
+			return nil
+		}
+		if err := t.store.Delete(ctx, box.Key); err != nil {
+			return err
+		}
+		change.Deleted = true
+	} else {
+		if err := t.store.Put(ctx, box.Key, box.Value); err != nil {
+			return err
+		}
+		change.Value = box.Value
+	}
+	t.mu.RLock()
+	callbacks := t.onChange
+	t.mu.RUnlock()
+	for _, fn := range callbacks {
+		fn(ctx, change)
+	}
+	return nil
+}
+
+// checkCaughtUp 各分区均读取到启动时的最新偏移量后标记为已追上。
+func (t *Table) checkCaughtUp() {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for p, newest := range t.watermark {
+		if t.progress[p] < newest {
+			return
+		}
+	}
+	t.caughtOne.Do(func() { close(t.caughtUp) })
+}
+
+// WaitUntilCaughtUp 等待读取到Start时主题的最新偏移量，写入存储失败而停止读取或ctx结束时返回错误。
+func (t *Table) WaitUntilCaughtUp(ctx context.Context) error {
+	if err := t.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-t.caughtUp:
+		return nil
+	case <-t.failed:
+		return t.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get 读取键的最新值，不存在时返回false。
+func (t *Table) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return t.store.Get(ctx, key)
+}
+
+// Range 按键的顺序遍历全部键值，fn返回false时停止。
+func (t *Table) Range(ctx context.Context, fn func(key string, value []byte) bool) error {
+	return t.store.Range(ctx, fn)
+}
@@ -0,0 +1,147 @@
+package kafkaex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryTableStore 基于内存的Table存储。
+type MemoryTableStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryTableStore 创建并返回一个新的MemoryTableStore实例。
+func NewMemoryTableStore() *MemoryTableStore {
+	return &MemoryTableStore{data: map[string][]byte{}}
+}
+
+// Reset 清空全部键值。
+func (s *MemoryTableStore) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = map[string][]byte{}
+	return nil
+}
+
+// Put 写入键值。
+func (s *MemoryTableStore) Put(ctx context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return nil
+}
+
+// Delete 删除键。
+func (s *MemoryTableStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+// Get 读取键值，不存在时返回false。
+func (s *MemoryTableStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.data[key]
+	return v, ok, nil
+}
+
+// Range 按键的顺序遍历键值，fn返回false时停止。
+func (s *MemoryTableStore) Range(ctx context.Context, fn func(key string, value []byte) bool) error {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.data))
+	for k := range s.data {
+		keys = append(keys, k)
+	}
+	s.mu.RUnlock()
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, ok, _ := s.Get(ctx, k)
+		if ok && !fn(k, v) {
+			break
+		}
+	}
+	return nil
+}
+
+// SQLTableStore 基于database/sql的Table存储，可使用SQLite文件将大表保存在磁盘上，驱动由调用方引入。
+type SQLTableStore struct {
+	db      *sql.DB
+	dialect string
+	table   string
+}
+
+// NewSQLTableStore 创建并返回一个新的SQLTableStore实例，table为空时使用kafkaex_table，多个Table需使用不同的表。
+func NewSQLTableStore(db *sql.DB, dialect, table string) *SQLTableStore {
+	if table == "" {
+		table = "kafkaex_table"
+	}
+	return &SQLTableStore{db: db, dialect: dialect, table: table}
+}
+
+// Migrate 创建键值表，表已存在时不做处理。
+func (s *SQLTableStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	k VARCHAR(255) PRIMARY KEY,
+	v TEXT NOT NULL
+)`, s.table))
+	return err
+}
+
+// Reset 清空全部键值。
+func (s *SQLTableStore) Reset(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", s.table))
+	return err
+}
+
+// Put 写入键值，键已存在时覆盖。
+func (s *SQLTableStore) Put(ctx context.Context, key string, value []byte) error {
+	query := fmt.Sprintf("INSERT INTO %s (k, v) VALUES (%s) ON CONFLICT (k) DO UPDATE SET v = excluded.v",
+		s.table, sqlPlaceholders(s.dialect, 1, 2))
+	_, err := s.db.ExecContext(ctx, query, key, string(value))
+	return err
+}
+
+// Delete 删除键。
+func (s *SQLTableStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE k = %s", s.table, sqlPlaceholder(s.dialect, 1)), key)
+	return err
+}
+
+// Get 读取键值，不存在时返回false。
+func (s *SQLTableStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var v string
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT v FROM %s WHERE k = %s", s.table, sqlPlaceholder(s.dialect, 1)), key).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return []byte(v), true, nil
+}
+
+// Range 按键的顺序遍历键值，fn返回false时停止。
+func (s *SQLTableStore) Range(ctx context.Context, fn func(key string, value []byte) bool) error {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT k, v FROM %s ORDER BY k", s.table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		if !fn(k, []byte(v)) {
+			break
+		}
+	}
+	return rows.Err()
+}
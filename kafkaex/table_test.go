@@ -0,0 +1,175 @@
+package kafkaex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/stretchr/testify/assert"
+)
+
+// publishKV 发布一条键值消息，value为nil时为墓碑消息。
+func publishKV(t *testing.T, m IManager, topic, key string, value []byte) {
+	box := NewBoxMessage().WithOption(WithKey(key))
+	box.Value = value
+	assert.Nil(t, m.Publish(topic, box))
+}
+
+func TestTable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	publishKV(t, m, "flags", "a", []byte("on"))
+	publishKV(t, m, "flags", "b", []byte("off"))
+	publishKV(t, m, "flags", "c", []byte("on"))
+
+	table := m.NewTable("flags")
+	changes := make(chan *TableChange, 10)
+	table.OnChange(func(ctx context.Context, change *TableChange) {
+		changes <- change
+	})
+	assert.Nil(t, table.Start(ctx))
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	assert.Nil(t, table.WaitUntilCaughtUp(waitCtx))
+	v, ok, err := table.Get(ctx, "b")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "off", string(v))
+	assert.Len(t, changes, 3)
+	for len(changes) > 0 {
+		<-changes
+	}
+
+	// 更新与墓碑消息
+	publishKV(t, m, "flags", "b", []byte("on"))
+	change := <-changes
+	assert.Equal(t, &TableChange{Key: "b", Value: []byte("on"), Old: []byte("off")}, change)
+	publishKV(t, m, "flags", "a", nil)
+	change = <-changes
+	assert.Equal(t, &TableChange{Key: "a", Old: []byte("on"), Deleted: true}, change)
+	_, ok, _ = table.Get(ctx, "a")
+	assert.False(t, ok)
+
+	keys := []string{}
+	assert.Nil(t, table.Range(ctx, func(key string, value []byte) bool {
+		keys = append(keys, key+"="+string(value))
+		return true
+	}))
+	assert.Equal(t, []string{"b=on", "c=on"}, keys)
+}
+
+func TestTableEmptyTopic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	table := m.NewTable("empty")
+	assert.Nil(t, table.Start(ctx))
+	// 空主题启动后立即追上
+	waitCtx, waitCancel := context.WithTimeout(ctx, time.Second)
+	defer waitCancel()
+	assert.Nil(t, table.WaitUntilCaughtUp(waitCtx))
+}
+
+// failingTableStore 写入指定键时失败的存储。
+type failingTableStore struct {
+	*MemoryTableStore
+	key string
+}
+
+func (s *failingTableStore) Put(ctx context.Context, key string, value []byte) error {
+	if key == s.key {
+		return errors.New("disk full")
+	}
+	return s.MemoryTableStore.Put(ctx, key, value)
+}
+
+func TestTableApplyError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewMemoryManager().(*WaterMillManager)
+	publishKV(t, m, "flags", "a", []byte("on"))
+	publishKV(t, m, "flags", "b", []byte("off"))
+
+	table := m.NewTable("flags", WithTableStore(&failingTableStore{MemoryTableStore: NewMemoryTableStore(), key: "b"}))
+	assert.Nil(t, table.Start(ctx))
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	// 写入失败时停止读取并返回错误，不再视为已追上
+	assert.EqualError(t, table.WaitUntilCaughtUp(waitCtx), "disk full")
+	assert.EqualError(t, table.Err(), "disk full")
+	assert.Eventually(t, func() bool {
+		return m.Subscriptions()[0].State == SubscriptionError
+	}, 5*time.Second, 5*time.Millisecond)
+	// 不能重复启动
+	assert.Equal(t, ErrTableStarted, table.Start(ctx))
+}
+
+// closeCountSubscriber 记录关闭次数的订阅者。
+type closeCountSubscriber struct {
+	message.Subscriber
+	closed *atomic.Int32
+}
+
+func (s closeCountSubscriber) Close() error {
+	s.closed.Add(1)
+	return nil
+}
+
+func TestTableCloseSubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pubsub := gochannel.NewGoChannel(gochannel.Config{Persistent: true}, NewWaterMillLogger())
+	closed := &atomic.Int32{}
+	m := NewWaterMillManager(
+		WithSubscriberFactory(func(group string, ow func(*sarama.Config) *sarama.Config) (message.Subscriber, error) {
+			return closeCountSubscriber{Subscriber: pubsub, closed: closed}, nil
+		}),
+		WithWatermarks(func(ctx context.Context, topic string) (map[int32]int64, error) {
+			return map[int32]int64{}, nil
+		}),
+	)
+	assert.Nil(t, m.(*WaterMillManager).NewTable("flags").Start(ctx))
+	// 上下文结束后关闭Start创建的订阅者
+	cancel()
+	assert.Eventually(t, func() bool {
+		return closed.Load() == 1
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestSQLTableStore(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	store := NewSQLTableStore(db, DialectSQLite, "")
+	assert.Nil(t, store.Migrate(ctx))
+
+	assert.Nil(t, store.Put(ctx, "b", []byte("2")))
+	assert.Nil(t, store.Put(ctx, "a", []byte("1")))
+	assert.Nil(t, store.Put(ctx, "b", []byte("3")))
+	v, ok, err := store.Get(ctx, "b")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "3", string(v))
+	kv := []string{}
+	assert.Nil(t, store.Range(ctx, func(key string, value []byte) bool {
+		kv = append(kv, key+"="+string(value))
+		return true
+	}))
+	assert.Equal(t, []string{"a=1", "b=3"}, kv)
+
+	assert.Nil(t, store.Delete(ctx, "a"))
+	_, ok, err = store.Get(ctx, "a")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, store.Reset(ctx))
+	_, ok, _ = store.Get(ctx, "b")
+	assert.False(t, ok)
+}
@@ -0,0 +1,266 @@
+package kafkaex
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+)
+
+// 主题配置名
+const (
+	topicConfigRetention         = "retention.ms"        // 消息保留时长(毫秒)
+	topicConfigCleanupPolicy     = "cleanup.policy"      // 清理策略
+	topicConfigMinInsyncReplicas = "min.insync.replicas" // 最少同步副本数
+)
+
+// TopicSpec 定义了主题的声明式配置，未设置的字段不参与差异比对。
+type TopicSpec struct {
+	Name              string            `json:"name" yaml:"name"`                                               // 主题名
+	Partitions        int32             `json:"partitions" yaml:"partitions"`                                   // 分区数
+	ReplicationFactor int16             `json:"replicationFactor" yaml:"replicationFactor"`                     // 副本数
+	Retention         time.Duration     `json:"retention,omitempty" yaml:"retention,omitempty"`                 // 消息保留时长，对应retention.ms，YAML中可写为168h
+	CleanupPolicy     string            `json:"cleanupPolicy,omitempty" yaml:"cleanupPolicy,omitempty"`         // 清理策略，delete或compact，对应cleanup.policy
+	MinInsyncReplicas int               `json:"minInsyncReplicas,omitempty" yaml:"minInsyncReplicas,omitempty"` // 最少同步副本数，对应min.insync.replicas
+	Configs           map[string]string `json:"configs,omitempty" yaml:"configs,omitempty"`                     // 其他主题配置，如segment.bytes
+}
+
+// ConfigEntries 返回合并后的主题配置，Retention、CleanupPolicy与MinInsyncReplicas优先于Configs中的同名配置。
+func (s *TopicSpec) ConfigEntries() map[string]string {
+	entries := map[string]string{}
+	for k, v := range s.Configs {
+		entries[k] = v
+	}
+	if s.Retention != 0 {
+		entries[topicConfigRetention] = cast.ToString(s.Retention.Milliseconds())
+	}
+	if s.CleanupPolicy != "" {
+		entries[topicConfigCleanupPolicy] = s.CleanupPolicy
+	}
+	if s.MinInsyncReplicas > 0 {
+		entries[topicConfigMinInsyncReplicas] = cast.ToString(s.MinInsyncReplicas)
+	}
+	return entries
+}
+
+// TopicDetail 转换为sarama的主题配置。
+func (s *TopicSpec) TopicDetail() *sarama.TopicDetail {
+	detail := &sarama.TopicDetail{
+		NumPartitions:     s.Partitions,
+		ReplicationFactor: s.ReplicationFactor,
+		ConfigEntries:     map[string]*string{},
+	}
+	if detail.NumPartitions <= 0 {
+		detail.NumPartitions = 1
+	}
+	if detail.ReplicationFactor <= 0 {
+		detail.ReplicationFactor = 1
+	}
+	for k, v := range s.ConfigEntries() {
+		v := v
+		detail.ConfigEntries[k] = &v
+	}
+	return detail
+}
+
+// InnerTopicSpecs 返回共享的内置重试与死信主题的配置。
+func InnerTopicSpecs(partitions int32, replicationFactor int16) []*TopicSpec {
+	return []*TopicSpec{
+		{Name: APHMQITP_RETRY, Partitions: partitions, ReplicationFactor: replicationFactor},
+		{Name: APHMQITP_DEAD, Partitions: partitions, ReplicationFactor: replicationFactor},
+	}
+}
+
+// LoadTopicSpecs 从YAML文件中读取主题配置，文件内容为TopicSpec列表。
+func LoadTopicSpecs(path string) ([]*TopicSpec, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	specs := []*TopicSpec{}
+	if err := yaml.Unmarshal(bs, &specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// EnsureTopics 创建集群中不存在的主题，返回新创建的主题名。
+func EnsureTopics(admin sarama.ClusterAdmin, specs []*TopicSpec) ([]string, error) {
+	report, err := ProvisionTopics(admin, specs)
+	return report.Created, err
+}
+
+// TopicDrift 定义了主题配置与集群实际状态的一项差异。
+type TopicDrift struct {
+	Topic string `json:"topic"` // 主题名
+	Field string `json:"field"` // 差异项，topic(主题不存在)、partitions、replicationFactor或配置名
+	Want  string `json:"want"`  // 声明的值
+	Got   string `json:"got"`   // 集群中的值，未显式设置的配置为空
+}
+
+// ProvisionReport 定义了主题同步的结果。
+type ProvisionReport struct {
+	Created []string      `json:"created"` // 新创建的主题
+	Drifts  []*TopicDrift `json:"drifts"`  // 已存在主题与声明的差异
+	Applied []*TopicDrift `json:"applied"` // 已修正的差异
+}
+
+// provisionOptions 主题同步的配置
+type provisionOptions struct {
+	plan  bool
+	apply bool
+}
+
+// ProvisionOption 类型为函数，用于修改主题同步的配置
+type ProvisionOption func(*provisionOptions)
+
+// WithProvisionPlan 仅比对差异，不创建主题也不修改配置。
+func WithProvisionPlan() ProvisionOption {
+	return func(o *provisionOptions) {
+		o.plan = true
+	}
+}
+
+// WithProvisionApply 修正可修正的差异：增加分区数、修改主题配置。分区数减少与副本数变化只报告不修正。
+func WithProvisionApply() ProvisionOption {
+	return func(o *provisionOptions) {
+		o.apply = true
+	}
+}
+
+// ProvisionTopics 将主题配置与集群比对，创建缺失的主题并报告已存在主题的差异，配置WithProvisionApply时修正差异。
+func ProvisionTopics(admin sarama.ClusterAdmin, specs []*TopicSpec, opts ...ProvisionOption) (*ProvisionReport, error) {
+	o := &provisionOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	report := &ProvisionReport{Created: []string{}, Drifts: []*TopicDrift{}, Applied: []*TopicDrift{}}
+	exists, err := admin.ListTopics()
+	if err != nil {
+		return report, err
+	}
+	for _, spec := range specs {
+		detail, ok := exists[spec.Name]
+		if !ok {
+			if o.plan {
+				report.Drifts = append(report.Drifts, &TopicDrift{Topic: spec.Name, Field: "topic", Want: spec.Name})
+				continue
+			}
+			if err := admin.CreateTopic(spec.Name, spec.TopicDetail(), false); err != nil {
+				return report, err
+			}
+			report.Created = append(report.Created, spec.Name)
+			continue
+		}
+		detail.ConfigEntries = effectiveConfigs(admin, spec, detail.ConfigEntries)
+		drifts := diffTopic(spec, &detail)
+		report.Drifts = append(report.Drifts, drifts...)
+		if o.plan || !o.apply || len(drifts) == 0 {
+			continue
+		}
+		applied, err := applyTopicDrifts(admin, spec, drifts)
+		report.Applied = append(report.Applied, applied...)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// effectiveConfigs 补全ListTopics未返回的配置。ListTopics省略取默认值的配置，缺失时通过DescribeConfig获取生效的值，获取失败时保持缺失。
+func effectiveConfigs(admin sarama.ClusterAdmin, spec *TopicSpec, configs map[string]*string) map[string]*string {
+	missing := false
+	for k := range spec.ConfigEntries() {
+		if configs[k] == nil {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return configs
+	}
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: spec.Name})
+	if err != nil {
+		deflog.ErrorCtx(context.TODO(), "获取主题%s配置失败%v", spec.Name, err)
+		return configs
+	}
+	res := make(map[string]*string, len(configs)+len(entries))
+	for k, v := range configs {
+		res[k] = v
+	}
+	for _, e := range entries {
+		if res[e.Name] == nil {
+			v := e.Value
+			res[e.Name] = &v
+		}
+	}
+	return res
+}
+
+// diffTopic 比对主题配置与集群中的主题详情，集群中缺失的配置视为取默认值，不报告差异。
+func diffTopic(spec *TopicSpec, detail *sarama.TopicDetail) []*TopicDrift {
+	drifts := []*TopicDrift{}
+	if spec.Partitions > 0 && spec.Partitions != detail.NumPartitions {
+		drifts = append(drifts, &TopicDrift{Topic: spec.Name, Field: "partitions", Want: cast.ToString(spec.Partitions), Got: cast.ToString(detail.NumPartitions)})
+	}
+	if spec.ReplicationFactor > 0 && spec.ReplicationFactor != detail.ReplicationFactor {
+		drifts = append(drifts, &TopicDrift{Topic: spec.Name, Field: "replicationFactor", Want: cast.ToString(spec.ReplicationFactor), Got: cast.ToString(detail.ReplicationFactor)})
+	}
+	entries := spec.ConfigEntries()
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := detail.ConfigEntries[k]
+		if v == nil {
+			continue // 无法获取生效值时不报告差异
+		}
+		if *v != entries[k] {
+			drifts = append(drifts, &TopicDrift{Topic: spec.Name, Field: k, Want: entries[k], Got: *v})
+		}
+	}
+	return drifts
+}
+
+// applyTopicDrifts 修正主题的差异，返回已修正的差异。
+func applyTopicDrifts(admin sarama.ClusterAdmin, spec *TopicSpec, drifts []*TopicDrift) ([]*TopicDrift, error) {
+	applied := []*TopicDrift{}
+	configs := map[string]sarama.IncrementalAlterConfigsEntry{}
+	changed := []*TopicDrift{}
+	for _, d := range drifts {
+		switch d.Field {
+		case "partitions":
+			if spec.Partitions <= cast.ToInt32(d.Got) {
+				continue // 分区数不可减少
+			}
+			if err := admin.CreatePartitions(spec.Name, spec.Partitions, nil, false); err != nil {
+				return applied, err
+			}
+			applied = append(applied, d)
+		case "replicationFactor":
+			continue // 副本数需要重新分配分区，不自动修正
+		default:
+			v := d.Want
+			configs[d.Field] = sarama.IncrementalAlterConfigsEntry{Operation: sarama.IncrementalAlterConfigsOperationSet, Value: &v}
+			changed = append(changed, d)
+		}
+	}
+	if len(configs) > 0 {
+		if err := admin.IncrementalAlterConfig(sarama.TopicResource, spec.Name, configs, false); err != nil {
+			return applied, err
+		}
+		applied = append(applied, changed...)
+	}
+	return applied, nil
+}
+
+// NewClusterAdmin 使用当前的Kafka连接配置创建集群管理客户端。
+func NewClusterAdmin() (sarama.ClusterAdmin, error) {
+	return sarama.NewClusterAdmin(getKafkaBrokers(), getConfig())
+}
@@ -0,0 +1,141 @@
+package kafkaex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockClusterAdmin 记录主题变更的ClusterAdmin，未实现的方法调用时会panic。
+type mockClusterAdmin struct {
+	sarama.ClusterAdmin
+	topics   map[string]sarama.TopicDetail
+	defaults map[string]string // ListTopics省略的默认配置
+}
+
+func (m *mockClusterAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	return m.topics, nil
+}
+
+func (m *mockClusterAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+	m.topics[topic] = *detail
+	return nil
+}
+
+func (m *mockClusterAdmin) CreatePartitions(topic string, count int32, assignment [][]int32, validateOnly bool) error {
+	detail := m.topics[topic]
+	detail.NumPartitions = count
+	m.topics[topic] = detail
+	return nil
+}
+
+func (m *mockClusterAdmin) IncrementalAlterConfig(resourceType sarama.ConfigResourceType, name string, entries map[string]sarama.IncrementalAlterConfigsEntry, validateOnly bool) error {
+	detail := m.topics[name]
+	for k, v := range entries {
+		detail.ConfigEntries[k] = v.Value
+	}
+	m.topics[name] = detail
+	return nil
+}
+
+func (m *mockClusterAdmin) DescribeConfig(resource sarama.ConfigResource) ([]sarama.ConfigEntry, error) {
+	entries := []sarama.ConfigEntry{}
+	for k, v := range m.defaults {
+		entries = append(entries, sarama.ConfigEntry{Name: k, Value: v, Default: true})
+	}
+	return entries, nil
+}
+
+func (m *mockClusterAdmin) Close() error {
+	return nil
+}
+
+func newMockClusterAdmin() *mockClusterAdmin {
+	policy := "delete"
+	return &mockClusterAdmin{topics: map[string]sarama.TopicDetail{
+		"orders": {NumPartitions: 3, ReplicationFactor: 2, ConfigEntries: map[string]*string{"cleanup.policy": &policy}},
+	}}
+}
+
+func TestLoadTopicSpecs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topics.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(`
+- name: orders
+  partitions: 6
+  replicationFactor: 3
+  retention: 168h
+  cleanupPolicy: compact
+  minInsyncReplicas: 2
+  configs:
+    segment.bytes: "1048576"
+`), 0o644))
+	specs, err := LoadTopicSpecs(path)
+	assert.Nil(t, err)
+	assert.Len(t, specs, 1)
+	assert.Equal(t, 168*time.Hour, specs[0].Retention)
+	assert.Equal(t, map[string]string{
+		"retention.ms":        "604800000",
+		"cleanup.policy":      "compact",
+		"min.insync.replicas": "2",
+		"segment.bytes":       "1048576",
+	}, specs[0].ConfigEntries())
+}
+
+func TestProvisionTopics(t *testing.T) {
+	specs := append(InnerTopicSpecs(1, 1), &TopicSpec{Name: "orders", Partitions: 6, ReplicationFactor: 3, CleanupPolicy: "compact"})
+
+	// 仅比对差异时不修改集群
+	admin := newMockClusterAdmin()
+	report, err := ProvisionTopics(admin, specs, WithProvisionPlan())
+	assert.Nil(t, err)
+	assert.Empty(t, report.Created)
+	assert.Len(t, report.Drifts, 5)
+	assert.Len(t, admin.topics, 1)
+
+	// 默认创建缺失的主题并报告差异
+	report, err = ProvisionTopics(admin, specs)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{APHMQITP_RETRY, APHMQITP_DEAD}, report.Created)
+	assert.Equal(t, []*TopicDrift{
+		{Topic: "orders", Field: "partitions", Want: "6", Got: "3"},
+		{Topic: "orders", Field: "replicationFactor", Want: "3", Got: "2"},
+		{Topic: "orders", Field: "cleanup.policy", Want: "compact", Got: "delete"},
+	}, report.Drifts)
+	assert.Empty(t, report.Applied)
+	assert.Equal(t, int32(3), admin.topics["orders"].NumPartitions)
+
+	// 修正差异时副本数只报告不修正
+	report, err = ProvisionTopics(admin, specs, WithProvisionApply())
+	assert.Nil(t, err)
+	assert.Len(t, report.Applied, 2)
+	assert.Equal(t, int32(6), admin.topics["orders"].NumPartitions)
+	assert.Equal(t, "compact", *admin.topics["orders"].ConfigEntries["cleanup.policy"])
+
+	report, err = ProvisionTopics(admin, specs)
+	assert.Nil(t, err)
+	assert.Equal(t, []*TopicDrift{{Topic: "orders", Field: "replicationFactor", Want: "3", Got: "2"}}, report.Drifts)
+}
+
+func TestProvisionTopicsDefaultConfigs(t *testing.T) {
+	admin := newMockClusterAdmin()
+	admin.defaults = map[string]string{"retention.ms": "604800000", "segment.bytes": "1073741824"}
+	specs := []*TopicSpec{{Name: "orders", CleanupPolicy: "delete", Retention: 168 * time.Hour, Configs: map[string]string{"segment.bytes": "1048576"}}}
+
+	// 声明的值与默认值相同时不报告差异，缺失的配置以生效的值比对
+	report, err := ProvisionTopics(admin, specs, WithProvisionPlan())
+	assert.Nil(t, err)
+	assert.Equal(t, []*TopicDrift{{Topic: "orders", Field: "segment.bytes", Want: "1048576", Got: "1073741824"}}, report.Drifts)
+}
+
+func TestWithTopicProvision(t *testing.T) {
+	admin := newMockClusterAdmin()
+	NewWaterMillManager(WithTopicProvision(func() (sarama.ClusterAdmin, error) {
+		return admin, nil
+	}, InnerTopicSpecs(3, 1)))
+	assert.Contains(t, admin.topics, APHMQITP_RETRY)
+	assert.Equal(t, int32(3), admin.topics[APHMQITP_DEAD].NumPartitions)
+}
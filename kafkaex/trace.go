@@ -0,0 +1,112 @@
+package kafkaex
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName 链路追踪使用的instrumentation名称
+const tracerName = "github.com/illidaris/watermillex/kafkaex"
+
+// 定义链路追踪相关的全局变量，未设置时使用otel全局TracerProvider与W3C传播器。
+var (
+	tracerProvider trace.TracerProvider          // 链路追踪提供者
+	propagator     propagation.TextMapPropagator // 上下文传播器
+)
+
+// SetTracerProvider 设置链路追踪提供者。
+func SetTracerProvider(tp trace.TracerProvider) {
+	tracerProvider = tp
+}
+
+// SetPropagator 设置上下文传播器。
+func SetPropagator(p propagation.TextMapPropagator) {
+	propagator = p
+}
+
+// getTracer 返回配置的Tracer，若未配置则使用otel全局TracerProvider。
+func getTracer() trace.Tracer {
+	tp := tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// getPropagator 返回配置的传播器，若未配置则返回W3C TraceContext与Baggage的组合。
+func getPropagator() propagation.TextMapPropagator {
+	if propagator == nil {
+		return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	}
+	return propagator
+}
+
+// WithContext 将ctx中的链路上下文以及白名单内的上下文键值注入到BoxMessage中，发布时将以此作为父级。
+func (m *BoxMessage) WithContext(ctx context.Context) *BoxMessage {
+	if m.Propagation == nil {
+		m.Propagation = map[string]string{}
+	}
+	getPropagator().Inject(ctx, propagation.MapCarrier(m.Propagation))
+	m.Metas = captureMetas(ctx, m.Metas)
+	return m
+}
+
+// Context 从BoxMessage中提取链路上下文，并附加到ctx上返回。
+func (m *BoxMessage) Context(ctx context.Context) context.Context {
+	if len(m.Propagation) == 0 {
+		return ctx
+	}
+	return getPropagator().Extract(ctx, propagation.MapCarrier(m.Propagation))
+}
+
+// startPublishSpan 以BoxMessage携带的链路为父级创建发布Span，并将新Span注入BoxMessage。
+func startPublishSpan(topic string, box *BoxMessage) trace.Span {
+	ctx, span := getTracer().Start(box.Context(context.Background()), topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(spanAttributes(topic, box)...),
+	)
+	box.WithContext(ctx)
+	if sc := span.SpanContext(); box.TraceId == "" && sc.HasTraceID() {
+		box.TraceId = sc.TraceID().String()
+	}
+	return span
+}
+
+// startConsumeSpan 以消息头中提取的链路为父级创建消费Span，并链接到发布Span。
+func startConsumeSpan(ctx context.Context, topic, group string, box *BoxMessage) (context.Context, trace.Span) {
+	ctx = box.Context(ctx)
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(spanAttributes(topic, box)...),
+		trace.WithAttributes(attribute.String("messaging.kafka.consumer.group", group)),
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: sc}))
+	}
+	return getTracer().Start(ctx, topic+" process", opts...)
+}
+
+// endSpan 结束Span，若存在错误则记录错误并设置状态。
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// spanAttributes 返回消息相关的Span属性。
+func spanAttributes(topic string, box *BoxMessage) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.message.id", box.MsgId),
+		attribute.String("messaging.kafka.message.key", box.Key),
+		attribute.Int64("messaging.kafka.retry.index", box.RetryIndex),
+	}
+}
@@ -0,0 +1,75 @@
+package kafkaex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/illidaris/core"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracePropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	SetTracerProvider(tp)
+	defer SetTracerProvider(nil)
+
+	// 调用方的链路
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	box := NewBoxMessage().WithOption(WithTopic("topic1")).WithContext(ctx)
+	root.End()
+
+	// 发布
+	span := startPublishSpan("topic1", box)
+	endSpan(span, nil)
+	msg := box.NewRawMessage()
+	assert.NotEmpty(t, msg.Metadata.Get("traceparent"))
+	assert.Equal(t, root.SpanContext().TraceID().String(), box.TraceId)
+
+	// 消费
+	var handleCtx context.Context
+	process, err := processHanlder(GetManager(), "topic1", "execer", NewOptions(WithGroup("group1"), WithHandle(func(ctx context.Context, box *BoxMessage) error {
+		handleCtx = ctx
+		return nil
+	})))
+	assert.Nil(t, err)
+	ch := make(chan *message.Message, 1)
+	ch <- msg
+	close(ch)
+	process(context.Background(), ch)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 3)
+	pub, sub := spans[1], spans[2]
+	assert.Equal(t, "topic1 publish", pub.Name)
+	assert.Equal(t, trace.SpanKindProducer, pub.SpanKind)
+	assert.Equal(t, root.SpanContext().SpanID(), pub.Parent.SpanID())
+	assert.Equal(t, "topic1 process", sub.Name)
+	assert.Equal(t, trace.SpanKindConsumer, sub.SpanKind)
+	assert.Equal(t, pub.SpanContext.SpanID(), sub.Parent.SpanID())
+	assert.Len(t, sub.Links, 1)
+	assert.Equal(t, pub.SpanContext.SpanID(), sub.Links[0].SpanContext.SpanID())
+
+	// 处理函数的ctx携带消费Span与TraceID
+	assert.Equal(t, sub.SpanContext.SpanID(), trace.SpanContextFromContext(handleCtx).SpanID())
+	assert.Equal(t, box.TraceId, core.TraceID.GetString(handleCtx))
+}
+
+func TestBoxMessageContext(t *testing.T) {
+	box := NewBoxMessage()
+	// 无链路信息时原样返回
+	ctx := context.Background()
+	assert.Equal(t, ctx, box.Context(ctx))
+
+	headers := map[string]string{
+		"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	}
+	box.WithHeadersOption(headers)
+	sc := trace.SpanContextFromContext(box.Context(ctx))
+	assert.True(t, sc.IsRemote())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", sc.TraceID().String())
+}